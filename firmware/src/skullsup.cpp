@@ -27,6 +27,9 @@
 // Addresses all LEDs when loading a frame. 0x3e - 0x00 address single LEDs
 #define ALL_LEDS        0x3f
 
+// CMD_REANIMATE flag: play the frames once, then hold the final frame
+#define REANIMATE_ONCE  0x01
+
 static enum {
     STATE_SLEEP = 0,
     STATE_IDLE,
@@ -46,6 +49,7 @@ static struct frame {
 static uint8_t frame_idx;           // Current animation frame
 static uint8_t frame_count;         // Total # of animation frames
 static uint16_t frame_dur_ms;       // frame duration in ms
+static bool reanimate_once;         // Stop after playing the frames once
 
 #define CMD_BUF_LEN 4
 static uint8_t cmd_idx = 0;         // Current index into command buffer
@@ -162,6 +166,7 @@ inline uint8_t process_cmd() {
         case CMD_REANIMATE:
             frame_idx = 0;
             frame_dur_ms = ((uint16_t) cmd_buf[1] << 8) | cmd_buf[2];
+            reanimate_once = (cmd_buf[3] & REANIMATE_ONCE) != 0;
             state = STATE_REANIMATED;
             break;
 
@@ -249,7 +254,13 @@ void loop()
                 // Display the current frame
                 show_frame(&frames[frame_idx]);
                 if (++frame_idx >= frame_count) {
-                    frame_idx = 0;
+                    if (reanimate_once) {
+                        // Hold the final frame until we're summoned
+                        leds.show();
+                        enter_idle_state();
+                    } else {
+                        frame_idx = 0;
+                    }
                 }
             }
 			break;
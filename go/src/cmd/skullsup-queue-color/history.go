@@ -0,0 +1,60 @@
+// SPDX License Identifier: MIT
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jynik/skullsup/go/src/color"
+)
+
+// Default location of the history of previously written colors
+func defaultHistoryPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "skullsup", "color-history")
+}
+
+// Load previously written colors, one per line. A missing history file
+// is treated as an empty history.
+func loadHistory(filename string) ([]color.Color, error) {
+	var ret []color.Color
+
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return ret, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+
+		c, err := color.New(line)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, c)
+	}
+
+	return ret, nil
+}
+
+func saveHistory(filename string, history []color.Color) error {
+	var lines []string
+	for _, c := range history {
+		lines = append(lines, c.String()+"\n")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filename, []byte(strings.Join(lines, "")), 0600)
+}
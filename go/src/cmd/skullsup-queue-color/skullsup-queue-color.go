@@ -7,7 +7,7 @@ import (
 	"math/rand"
 	"os"
 	"path"
-	"time"
+	"strings"
 
 	"github.com/jynik/skullsup/go/src/cmdline"
 	"github.com/jynik/skullsup/go/src/color"
@@ -29,12 +29,59 @@ func usage() {
 	os.Exit(0)
 }
 
+const generatorHelp = "Color generator to use: yuv, hsv, or oklab. " +
+	"The hsv and oklab generators honor the saturation and brightness options."
+
+const distinctHelp = "Choose a color that is distinct from the previous N " +
+	"colors written by this program."
+
+// Minimum perceptual distance between colors in -distinct mode
+const distinctDistance = 0.15
+
+// Returns a random color generator based upon the command-line options
+func generator(name string, palette *color.Palette, c color.Constraints) (func(*rand.Rand) color.Color, error) {
+	if palette != nil {
+		return palette.Random, nil
+	}
+
+	switch strings.ToLower(name) {
+	case "yuv":
+		return func(rng *rand.Rand) color.Color {
+			return color.Random(rng, 10, 256)
+		}, nil
+
+	case "hsv":
+		return func(rng *rand.Rand) color.Color {
+			return color.RandomHSV(rng, c)
+		}, nil
+
+	case "oklab":
+		return func(rng *rand.Rand) color.Color {
+			return color.RandomOKLab(rng, c)
+		}, nil
+	}
+
+	return nil, fmt.Errorf("Invalid color generator: %s", name)
+}
+
 func main() {
+	var constraints color.Constraints
+
 	var flags cmdline.WriterFlags
 
 	flags.Period = -1 // Don't use this option
 	flags.Init()
 
+	seedArg := cmdline.SeedFlag()
+	paletteArg := flag.String("palette", "", "Choose a random color from the specified palette")
+	paletteFileArg := flag.String("palette-file", "", "Load additional palettes from the specified file")
+	generatorArg := flag.String("generator", "yuv", generatorHelp)
+	flag.Float64Var(&constraints.MinSaturation, "min-saturation", 0, "Minimum color saturation, in [0, 1]")
+	flag.Float64Var(&constraints.MaxSaturation, "max-saturation", 1, "Maximum color saturation, in [0, 1]")
+	flag.Float64Var(&constraints.MinBrightness, "min-brightness", 0.1, "Minimum color brightness, in [0, 1]")
+	flag.Float64Var(&constraints.MaxBrightness, "max-brightness", 1, "Maximum color brightness, in [0, 1]")
+	distinctArg := flag.Int("distinct", 0, distinctHelp)
+	historyArg := flag.String("history", defaultHistoryPath(), "File used to track previous colors for -distinct")
 	versionArg := flag.Bool("version", false, "Display program version and exit")
 	apiVersionArg := flag.Bool("api-version", false, "Display SkullsUp! API version and exit")
 
@@ -49,6 +96,30 @@ func main() {
 		return
 	}
 
+	var palette *color.Palette
+	if *paletteArg != "" {
+		var palettes []color.Palette
+		var err error
+
+		if *paletteFileArg != "" {
+			if palettes, err = color.LoadPalettes(*paletteFileArg); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+
+		if palette, err = color.LookupPalette(*paletteArg, palettes...); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	generate, err := generator(*generatorArg, palette, constraints)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
 	client, err := client.New(flags.Cfg)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -61,19 +132,42 @@ func main() {
 		os.Exit(3)
 	}
 
+	rng, seed := cmdline.NewRand(*seedArg)
+	client.Log.Info("Random seed: %d\n", seed)
+
 	queue := flags.Queue
 	if queue == "" {
 		queue = client.Cfg.WriteQueues[rand.Intn(numQueues)]
 	}
 	client.Log.Debug("Writing to %s\n", queue)
 
-	rand.Seed(time.Now().UTC().UnixNano())
+	var c color.Color
+	if *distinctArg > 0 {
+		d := color.Distinct{Generate: generate, Count: *distinctArg, MinDistance: distinctDistance}
+		if d.History, err = loadHistory(*historyArg); err != nil {
+			client.Log.Error("Failed to load color history: %s\n", err)
+		}
+
+		c = d.Next(rng)
+
+		if err = saveHistory(*historyArg, d.History); err != nil {
+			client.Log.Error("Failed to save color history: %s\n", err)
+		}
+	} else {
+		c = generate(rng)
+	}
+
 	msg := network.Message{
 		Command: network.CmdColor,
-		Args:    []string{color.Random(10, 256).String()},
+		Args:    []string{c.String()},
 		Period:  client.Cfg.FramePeriod,
 	}
 
+	if err := flags.Apply(&msg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
 	err = client.Write(&msg, queue)
 	if err != nil {
 		client.Log.Error("%s\n", err)
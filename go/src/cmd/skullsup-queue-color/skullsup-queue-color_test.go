@@ -0,0 +1,84 @@
+// SPDX License Identifier: MIT
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jynik/skullsup/go/src/cmdline"
+	"github.com/jynik/skullsup/go/src/color"
+)
+
+var constraints = color.Constraints{
+	MinSaturation: 0.2,
+	MaxSaturation: 1,
+	MinBrightness: 0.1,
+	MaxBrightness: 1,
+}
+
+// Generate a sequence of colors from the specified seed
+func colors(t *testing.T, seed int64, name string, palette *color.Palette, distinct int) []color.Color {
+	var ret []color.Color
+
+	generate, err := generator(name, palette, constraints)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rng, _ := cmdline.NewRand(seed)
+	d := color.Distinct{Generate: generate, Count: distinct, MinDistance: distinctDistance}
+
+	for i := 0; i < 32; i++ {
+		if distinct > 0 {
+			ret = append(ret, d.Next(rng))
+		} else {
+			ret = append(ret, generate(rng))
+		}
+	}
+
+	return ret
+}
+
+func TestGeneratorsReproducible(t *testing.T) {
+	palette, err := color.LookupPalette(color.Palettes[0].Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		palette  *color.Palette
+		distinct int
+	}{
+		{"yuv", nil, 0},
+		{"hsv", nil, 0},
+		{"oklab", nil, 0},
+		{"yuv", palette, 0},
+		{"yuv", nil, 4},
+		{"hsv", nil, 4},
+		{"oklab", nil, 4},
+	}
+
+	for _, test := range tests {
+		for _, seed := range []int64{1, 1234} {
+			a := colors(t, seed, test.name, test.palette, test.distinct)
+			b := colors(t, seed, test.name, test.palette, test.distinct)
+
+			if !reflect.DeepEqual(a, b) {
+				t.Errorf("%s (palette=%v, distinct=%d): seed %d produced different colors",
+					test.name, test.palette != nil, test.distinct, seed)
+			}
+		}
+
+		if reflect.DeepEqual(colors(t, 1, test.name, test.palette, test.distinct),
+			colors(t, 2, test.name, test.palette, test.distinct)) {
+			t.Errorf("%s: different seeds produced identical colors", test.name)
+		}
+	}
+}
+
+func TestInvalidGenerator(t *testing.T) {
+	if _, err := generator("cmyk", nil, constraints); err == nil {
+		t.Error("Expected an invalid generator to be rejected")
+	}
+}
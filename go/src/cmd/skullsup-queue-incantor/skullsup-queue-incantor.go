@@ -7,7 +7,6 @@ import (
 	"math/rand"
 	"os"
 	"path"
-	"time"
 
 	"github.com/jynik/skullsup/go/src/cmdline"
 	"github.com/jynik/skullsup/go/src/network"
@@ -41,6 +40,7 @@ func main() {
 	flag.Usage = usage
 
 	flag.StringVar(&psalmArg, "psalm", "", psalmArgHelp)
+	seedArg := cmdline.SeedFlag()
 	versionArg := flag.Bool("version", false, "Display program version and exit")
 	apiVersionArg := flag.Bool("api-version", false, "Display SkullsUp! API version and exit")
 
@@ -54,8 +54,6 @@ func main() {
 		return
 	}
 
-	rand.Seed(time.Now().UTC().UnixNano())
-
 	client, err := client.New(flags.Cfg)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -66,6 +64,9 @@ func main() {
 		client.Cfg.FramePeriod = flags.Period
 	}
 
+	rng, seed := cmdline.NewRand(*seedArg)
+	client.Log.Info("Random seed: %d\n", seed)
+
 	numQueues := len(client.Cfg.WriteQueues)
 	if numQueues < 1 {
 		fmt.Fprint(os.Stderr, "Client does not have any write queues configured.\n")
@@ -79,10 +80,15 @@ func main() {
 
 	msg := network.Message{
 		Command: network.CmdIncant,
-		Args:    psalm.Random(psalmArg),
+		Args:    psalm.Random(rng, psalmArg),
 		Period:  client.Cfg.FramePeriod,
 	}
 
+	if err := flags.Apply(&msg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
 	client.Log.Debug("Writing to %s\n", queue)
 
 	err = client.Write(&msg, queue)
@@ -6,23 +6,80 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
-	"strings"
 	"time"
 
 	"github.com/jynik/skullsup/go/src/device"
 	"github.com/jynik/skullsup/go/src/network"
 	"github.com/jynik/skullsup/go/src/network/client"
+	"github.com/jynik/skullsup/go/src/psalm/script"
 	"github.com/jynik/skullsup/go/src/version"
 )
 
 const Version = "1.0.0"
 
+// Message read from a queue
+type delivery struct {
+	queue string
+	msg   *network.Message
+}
+
 func update(c *client.Client, queue string, s *device.Skull) error {
 	msg, err := c.Read(queue)
 	if err != nil {
 		return err
 	}
+	return handle(c, delivery{queue, msg}, s)
+}
+
+// Display a message, and then acknowledge it. If the message could not be
+// displayed due to a failure to communicate with the device, the server is
+// asked to redeliver it. Messages that can never be displayed, such as those
+// with invalid arguments, are acknowledged and discarded.
+//
+// Animations that must be uploaded in segments may play for longer than the
+// server's visibility timeout, so these are acknowledged before playback
+// begins to avoid their redelivery.
+func handle(c *client.Client, d delivery, s *device.Skull) error {
+	var ackErr error
+	acked := false
+
+	s.OnSegmented(func() {
+		ackErr = c.Ack(d.queue, d.msg)
+		acked = true
+	})
+	defer s.OnSegmented(nil)
+
+	if err := apply(c, d.msg, s); err != nil {
+		if acked {
+			return err
+		}
+
+		if !device.IsIOError(err) {
+			if ackErr := c.Ack(d.queue, d.msg); ackErr != nil {
+				c.Log.Error("Failed to acknowledge message #%d: %s\n", d.msg.ID, ackErr)
+			}
+			return fmt.Errorf("Discarded message #%d: %s", d.msg.ID, err)
+		}
+
+		if nackErr := c.Nack(d.queue, d.msg); nackErr != nil {
+			c.Log.Error("Failed to reject message #%d: %s\n", d.msg.ID, nackErr)
+		}
+		return err
+	}
+
+	if !acked {
+		ackErr = c.Ack(d.queue, d.msg)
+	}
 
+	if ackErr != nil {
+		return fmt.Errorf("Failed to acknowledge message #%d: %s", d.msg.ID, ackErr)
+	}
+
+	return nil
+}
+
+// Display a message on the device
+func apply(c *client.Client, msg *network.Message, s *device.Skull) error {
 	if len(msg.Args) == 0 {
 		return fmt.Errorf("Received \"%s\" with no arguments", msg.Command)
 	}
@@ -58,6 +115,19 @@ func update(c *client.Client, queue string, s *device.Skull) error {
 
 		c.Log.Debug("Incanting %s with period=%d, args=%s\n", psalm, msg.Period, args)
 
+	case network.CmdScript:
+		p, err := script.Parse(msg.Args[0])
+		if err != nil {
+			return err
+		}
+
+		err = s.IncantPsalm(p, msg.Args[1:], uint16(msg.Period))
+		if err != nil {
+			return err
+		}
+
+		c.Log.Debug("Incanting script %s with period=%d, args=%s\n", p.Name, msg.Period, msg.Args[1:])
+
 	default:
 		c.Log.Error("Burning unknown command: %s\n", msg.Command)
 	}
@@ -65,10 +135,87 @@ func update(c *client.Client, queue string, s *device.Skull) error {
 	return nil
 }
 
+// Wait for messages to arrive in a queue, passing them along to be displayed
+func watch(c *client.Client, queue string, msgs chan<- delivery) {
+	pollPeriod := time.Duration(c.Cfg.PollPeriod) * time.Second
+
+	for /*ever!*/ {
+		c.Log.Debug("Waiting on queue: %s\n", queue)
+
+		start := time.Now()
+		msg, err := c.Read(queue)
+
+		if err != nil && network.ErrorCode(err) == network.CodeQueueEmpty {
+			// A server that does not support long-polling will respond
+			// immediately. Fall back to polling it periodically.
+			if time.Since(start) < c.LongPoll()/2 {
+				c.Log.Debug("Queue %s is empty. Retrying in %s\n", queue, pollPeriod)
+				time.Sleep(pollPeriod)
+			}
+		} else if err != nil {
+			c.Log.Error("%s: %s\n", queue, err)
+			time.Sleep(pollPeriod)
+		} else {
+			msgs <- delivery{queue, msg}
+		}
+	}
+}
+
+// Receive messages from a queue as they arrive, resubscribing if the
+// connection is lost
+func subscribe(c *client.Client, queue string, msgs chan<- delivery) {
+	pollPeriod := time.Duration(c.Cfg.PollPeriod) * time.Second
+	var lastID uint64
+
+	for /*ever!*/ {
+		sub, err := c.Subscribe(queue, lastID)
+		if err != nil {
+			c.Log.Error("%s: %s\n", queue, err)
+			time.Sleep(pollPeriod)
+			continue
+		}
+
+		c.Log.Debug("Subscribed to queue: %s\n", queue)
+
+		for {
+			msg, err := sub.Next()
+			if err != nil {
+				c.Log.Error("%s: %s\n", queue, err)
+				break
+			}
+			msgs <- delivery{queue, msg}
+		}
+
+		lastID = sub.LastID
+		sub.Close()
+		time.Sleep(time.Second)
+	}
+}
+
+// Wait on all queues concurrently, and display messages as they arrive
+func listen(c *client.Client, queues []string, s *device.Skull) {
+	msgs := make(chan delivery)
+
+	for _, queue := range queues {
+		if c.Cfg.Subscribe {
+			go subscribe(c, queue, msgs)
+		} else {
+			go watch(c, queue, msgs)
+		}
+	}
+
+	for d := range msgs {
+		if err := handle(c, d, s); err != nil {
+			c.Log.Error("%s\n", err)
+		}
+	}
+}
+
 func main() {
 	deviceArg := flag.String("device", "", "Device to connect to")
-	queueArg := flag.String("queue", "", "Read from a specific queue. Only used by -once.")
+	queueArg := flag.String("queue", "", "Read from a specific queue, rather than all configured queues.")
 	onceArg := flag.Bool("once", false, "Perform a single read and exit.")
+	subscribeArg := flag.Bool("subscribe", false, "Subscribe to queues rather than polling them.")
 	cfgFileArg := flag.String("cfg", client.FindDefaultConfig, "Configuration file to use")
 	versionArg := flag.Bool("version", false, "Display program version and exit")
 	apiVersionArg := flag.Bool("api-version", false, "Display SkullsUp! API version and exit")
@@ -128,6 +275,19 @@ func main() {
 		return
 	}
 
+	if *subscribeArg {
+		client.Cfg.Subscribe = true
+	}
+
+	if client.LongPoll() > 0 || client.Cfg.Subscribe {
+		queues := client.Cfg.ReadQueues
+		if *queueArg != "" {
+			queues = []string{*queueArg}
+		}
+
+		listen(client, queues, device)
+	}
+
 	loggedEmpty := 0
 	i := 0
 	for /*ever!*/ {
@@ -140,7 +300,7 @@ func main() {
 
 		err = update(client, readFrom, device)
 		if err != nil {
-			if strings.Contains(err.Error(), network.ErrorQueueEmpty) {
+			if network.ErrorCode(err) == network.CodeQueueEmpty {
 				// Avoid filling the logs with this
 				if loggedEmpty == 0 {
 					client.Log.Error("%s\n", err)
@@ -5,7 +5,9 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"path"
+	"syscall"
 
 	"github.com/jynik/skullsup/go/src/network/server"
 	"github.com/jynik/skullsup/go/src/version"
@@ -47,7 +49,19 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Ensure queued messages are flushed to storage before exiting
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		server.Close()
+	}()
+
 	err = server.Run()
+
+	// Wait for any in-progress Close() to complete
+	server.Close()
+
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(2)
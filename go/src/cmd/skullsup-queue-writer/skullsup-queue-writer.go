@@ -4,6 +4,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
 	"os"
 	"path"
@@ -14,6 +15,7 @@ import (
 	"github.com/jynik/skullsup/go/src/network"
 	"github.com/jynik/skullsup/go/src/network/client"
 	"github.com/jynik/skullsup/go/src/psalm"
+	"github.com/jynik/skullsup/go/src/psalm/script"
 	"github.com/jynik/skullsup/go/src/version"
 )
 
@@ -24,17 +26,42 @@ const usageText = "Usage: %s [options] <command> [arguments]\n" +
 	"Write a custom command to a SkullsUp! server" +
 	"\n" +
 	"Commands:\n" +
-	"  color <rrggbb>\n" +
-	"    Cast colored light upon the Dark Realm, specified as a 3-byte hex string.\n" +
+	"  color <color>\n" +
+	"    Cast colored light upon the Dark Realm, specified as a 3-byte hex string,\n" +
+	"    #rgb, a CSS color name, or as rgb(r,g,b), hsv(h,s,v), or hsl(h,s,l).\n" +
 	"  incant <psalm> [args]\n" +
 	"    Incant an unholy psalm, with optional changes to its common utterance.\n" +
+	"    Psalms may be combined, e.g., 'seq(pulse red, vortex lime black)', using\n" +
+	"    seq(a, b, ...), overlay(a, b, ...), and repeat(n, a[, hue degrees]).\n" +
 	"  list\n" +
 	"    List available psalms.\n" +
 	"  reanimate <frame> [frame] ...\n" +
 	"    Reanimate the undead in a manner of your choosing.\n" +
+	"  script <file> [args]\n" +
+	"    Incant a psalm of your own scripture.\n" +
+	"  status [queue] ...\n" +
+	"    Show the status of all available queues, or of the specified queues\n" +
+	"    along with their pending commands.\n" +
 	"\n" +
 	"Options:\n"
 
+// Read and validate a psalm script, returning its source
+func loadScript(filename string, args []string, period uint16) (string, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+
+	p, err := script.Parse(string(data))
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", filename, err)
+	} else if err := p.Validate(args, period); err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
 func usage() {
 	fmt.Fprintf(flag.CommandLine.Output(), usageText, path.Base(os.Args[0]))
 	flag.PrintDefaults()
@@ -62,21 +89,12 @@ func main() {
 	}
 
 	args := flag.Args()
+	showStatus := len(args) >= 1 && strings.ToLower(args[0]) == "status"
 
 	if len(args) == 1 && strings.ToLower(args[0]) == "list" {
-		psalms := psalm.List
-		fmt.Println("\nPsalms and optional arguments")
-		fmt.Println("------------------------------------------------------")
-		for _, p := range psalms {
-			line := fmt.Sprintf("  %-16s", p.Name)
-			for _, a := range p.ArgNames {
-				line += "[" + a + "] "
-			}
-			fmt.Println(line)
-		}
-		fmt.Println()
+		cmdline.PrintPsalms(os.Stdout, false)
 		os.Exit(0)
-	} else if len(args) < 2 {
+	} else if len(args) < 2 && !showStatus {
 		fmt.Fprintln(os.Stderr, "A command and associated argument are required.")
 		os.Exit(1)
 	}
@@ -87,6 +105,14 @@ func main() {
 		os.Exit(2)
 	}
 
+	if showStatus {
+		if err := status(os.Stdout, client, args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		return
+	}
+
 	if flags.Period > 0 {
 		client.Cfg.FramePeriod = flags.Period
 	}
@@ -110,6 +136,28 @@ func main() {
 		Period:  client.Cfg.FramePeriod,
 	}
 
+	// Catch invalid incantations before they're sent to the reader
+	switch strings.ToLower(msg.Command) {
+	case network.CmdIncant:
+		if err := psalm.Validate(msg.Args[0], msg.Args[1:], uint16(msg.Period)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+	case network.CmdScript:
+		source, err := loadScript(msg.Args[0], msg.Args[1:], uint16(msg.Period))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		msg.Args[0] = source
+	}
+
+	if err := flags.Apply(&msg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
 	err = client.Write(&msg, queue)
 	if err != nil {
 		client.Log.Error("%s\n", err)
@@ -0,0 +1,111 @@
+// SPDX License Identifier: MIT
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jynik/skullsup/go/src/network"
+	"github.com/jynik/skullsup/go/src/network/client"
+)
+
+func access(s network.QueueStatus) string {
+	ret := ""
+	if s.Read {
+		ret += "r"
+	}
+	if s.Write {
+		ret += "w"
+	}
+	if s.Topic {
+		ret += " (topic)"
+	}
+	return ret
+}
+
+func age(seconds float64) string {
+	if seconds == 0 {
+		return "-"
+	}
+	return (time.Duration(seconds * float64(time.Second))).Round(time.Second).String()
+}
+
+func printStatus(w io.Writer, queues []network.QueueStatus) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "QUEUE\tACCESS\tDEPTH\tIN FLIGHT\tSCHEDULED\tOLDEST")
+
+	for _, s := range queues {
+		fmt.Fprintf(tw, "%s\t%s\t%d/%d\t%d\t%d\t%s\n", s.Name, access(s),
+			s.Depth, s.MaxDepth, s.InFlight, s.Scheduled, age(s.OldestAge))
+
+		for _, sub := range s.Subscribers {
+			fmt.Fprintf(tw, "  %s\t\t%d/%d\t%d\t%d\t%s\n", sub.Name,
+				sub.Depth, sub.MaxDepth, sub.InFlight, sub.Scheduled, age(sub.OldestAge))
+		}
+	}
+
+	tw.Flush()
+}
+
+func printPending(w io.Writer, queue string, msgs []network.Message) {
+	fmt.Fprintf(w, "\nPending in %s:\n", queue)
+	if len(msgs) == 0 {
+		fmt.Fprintln(w, "  (none)")
+	}
+
+	for _, m := range msgs {
+		line := "  " + m.String()
+		if m.Priority > 0 {
+			line += fmt.Sprintf(" priority=%d", m.Priority)
+		}
+		if m.NotBefore != nil {
+			line += " at " + m.NotBefore.Local().Format(time.RFC3339)
+		}
+		if m.ExpiresAt != nil {
+			line += " expires " + m.ExpiresAt.Local().Format(time.RFC3339)
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// Display the status of the specified queues, or of all available queues if
+// none are specified. The pending messages of specified queues are also shown.
+func status(w io.Writer, c *client.Client, queues []string) error {
+	if len(queues) == 0 {
+		list, err := c.List()
+		if err != nil {
+			return err
+		}
+		printStatus(w, list)
+		return nil
+	}
+
+	var list []network.QueueStatus
+	pending := map[string][]network.Message{}
+
+	for _, queue := range queues {
+		s, err := c.Status(queue)
+		if err != nil {
+			return fmt.Errorf("%s: %s", queue, err)
+		}
+		list = append(list, *s)
+
+		// Topics' inboxes may only be viewed by their subscribers
+		if !s.Topic || s.Read {
+			if pending[queue], err = c.Peek(queue); err != nil {
+				return fmt.Errorf("%s: %s", queue, err)
+			}
+		}
+	}
+
+	printStatus(w, list)
+	for _, queue := range queues {
+		if msgs, ok := pending[queue]; ok {
+			printPending(w, queue, msgs)
+		}
+	}
+
+	return nil
+}
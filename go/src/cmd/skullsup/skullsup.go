@@ -5,15 +5,15 @@ import (
 	"errors"
 	"flag"
 	"fmt"
-	"math/rand"
 	"os"
 	"path"
 	"strings"
-	"time"
 
+	"github.com/jynik/skullsup/go/src/cmdline"
 	"github.com/jynik/skullsup/go/src/color"
 	"github.com/jynik/skullsup/go/src/device"
 	"github.com/jynik/skullsup/go/src/psalm"
+	"github.com/jynik/skullsup/go/src/psalm/script"
 	"github.com/jynik/skullsup/go/src/version"
 )
 
@@ -23,14 +23,19 @@ const usageText = "Usage: %s [options] <command> [arguments]\n" +
 	"Write a command to a locally-connected SkullsUp! device\n" +
 	"\n" +
 	"Commands:\n" +
-	"  color [rrggbb]\n" +
-	"    Cast colored light upon the Dark Realm, specified as a 3-byte hex string.\n" +
+	"  color [color]\n" +
+	"    Cast colored light upon the Dark Realm, specified as a 3-byte hex string,\n" +
+	"    #rgb, a CSS color name, or as rgb(r,g,b), hsv(h,s,v), or hsl(h,s,l).\n" +
 	"  incant [psalm] [args]\n" +
 	"    Incant an unholy psalm, with optional changes to its common utterance.\n" +
+	"    Psalms may be combined, e.g., 'seq(pulse red, vortex lime black)', using\n" +
+	"    seq(a, b, ...), overlay(a, b, ...), and repeat(n, a[, hue degrees]).\n" +
 	"  list\n" +
 	"    List available psalms.\n" +
 	"  reanimate <frame> [frame] ...\n" +
 	"    Reanimate the undead in a manner of your choosing.\n" +
+	"  script <file> [args]\n" +
+	"    Incant a psalm of your own scripture.\n" +
 	"\n" +
 	"Options:\n"
 
@@ -44,6 +49,7 @@ func usage() {
 func main() {
 	deviceArg := flag.String("device", "", "Specifies the Skull to command.")
 	periodArg := flag.Uint("period", 0, "Intra-frame period, in ms.")
+	seedArg := cmdline.SeedFlag()
 	versionArg := flag.Bool("version", false, "Display program version and exit")
 	apiVersionArg := flag.Bool("api-version", false, "Display SkullsUp! API version and exit")
 
@@ -70,20 +76,8 @@ func main() {
 	}
 
 	if strings.ToLower(args[0]) == "list" {
-		psalms := psalm.List
-		fmt.Println("\nPsalms and optional arguments")
-		fmt.Println("------------------------------------------------------")
-		fmt.Println("  random")
-		for _, p := range psalms {
-			line := fmt.Sprintf("  %-16s", p.Name)
-			for _, a := range p.ArgNames {
-				line += "[" + a + "] "
-			}
-			fmt.Println(line)
-		}
-		fmt.Println()
+		cmdline.PrintPsalms(os.Stdout, true)
 		return
-
 	}
 
 	skull, err := device.New(*deviceArg)
@@ -93,18 +87,20 @@ func main() {
 	}
 	defer skull.Close()
 
-	rand.Seed(time.Now().UTC().UnixNano())
+	rng, seed := cmdline.NewRand(*seedArg)
 
 	switch strings.ToLower(args[0]) {
 	case "color":
 		if len(args) > 1 {
 			err = skull.SetColor(args[1])
 		} else {
-			err = skull.SetColor(color.Random(16, 256).String())
+			fmt.Printf("Random seed: %d\n", seed)
+			err = skull.SetColor(color.Random(rng, 16, 256).String())
 		}
 	case "incant":
-		if len(args) < 2 || strings.ToLower(args[1]) == "random" {
-			psalmArgs := psalm.Random("")
+		if len(args) < 2 || strings.ToLower(args[1]) == psalm.RandomName {
+			fmt.Printf("Random seed: %d\n", seed)
+			psalmArgs := psalm.Random(rng, "")
 			err = skull.Incant(psalmArgs[0], psalmArgs[1:], uint16(*periodArg))
 		} else {
 			err = skull.Incant(args[1], args[2:], uint16(*periodArg))
@@ -112,6 +108,18 @@ func main() {
 
 	case "reanimate":
 		err = skull.Reanimate(args[1:], uint16(*periodArg))
+
+	case "script":
+		if len(args) < 2 {
+			err = errors.New("No script file provided.")
+			break
+		}
+
+		var p *psalm.Psalm
+		if p, err = script.Load(args[1]); err == nil {
+			err = skull.IncantPsalm(p, args[2:], uint16(*periodArg))
+		}
+
 	default:
 		err = errors.New("Invalid command: " + args[0])
 	}
@@ -0,0 +1,54 @@
+// SPDX License Identifier: MIT
+package cmdline
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/jynik/skullsup/go/src/psalm"
+)
+
+// Print the registered psalms and their arguments. If includeRandom is true,
+// the pseudo-psalm used to incant a random psalm is also listed.
+func PrintPsalms(w io.Writer, includeRandom bool) {
+	fmt.Fprintln(w, "\nPsalms and optional arguments")
+	fmt.Fprintln(w, "------------------------------------------------------")
+
+	if includeRandom {
+		fmt.Fprintf(w, "  %s\n", psalm.RandomName)
+		fmt.Fprintf(w, "      Incant a random psalm with random arguments.\n")
+	}
+
+	for _, p := range psalm.List {
+		line := fmt.Sprintf("  %-16s", p.Name)
+		for _, param := range p.Params {
+			if param.Default == "" {
+				line += "<" + param.Name + "> "
+			} else {
+				line += "[" + param.Name + "] "
+			}
+		}
+		fmt.Fprintln(w, line)
+
+		if p.Description != "" {
+			fmt.Fprintf(w, "      %s\n", p.Description)
+		}
+
+		if p.Author != "" {
+			fmt.Fprintf(w, "      Author: %s\n", p.Author)
+		}
+
+		for _, param := range p.Params {
+			fmt.Fprintf(w, "      %-14s%s\n", param.Name, param.Summary())
+			if param.Help != "" {
+				fmt.Fprintf(w, "      %-14s  %s\n", "", param.Help)
+			}
+		}
+
+		if p.Period.Max > 0 {
+			fmt.Fprintf(w, "      %-14s%d-%d ms\n", "period", p.Period.Min, p.Period.Max)
+		}
+	}
+
+	fmt.Fprintln(w)
+}
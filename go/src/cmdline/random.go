@@ -0,0 +1,31 @@
+// SPDX License Identifier: MIT
+package cmdline
+
+import (
+	"flag"
+	"math/rand"
+	"time"
+)
+
+const seedHelp = "Seed used to generate random colors and incantations, " +
+	"allowing them to be reproduced. A time-based seed is used if not specified."
+
+// Register a -seed flag
+func SeedFlag() *int64 {
+	return flag.Int64("seed", 0, seedHelp)
+}
+
+// Seed the global random number generator using the current time, and
+// return a generator for random colors and incantations. This generator uses
+// the provided seed, or a time-based seed if the provided seed is 0.
+// The seed used by the returned generator is also returned.
+func NewRand(seed int64) (*rand.Rand, int64) {
+	now := time.Now().UTC().UnixNano()
+	rand.Seed(now)
+
+	if seed == 0 {
+		seed = now
+	}
+
+	return rand.New(rand.NewSource(seed)), seed
+}
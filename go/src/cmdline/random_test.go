@@ -0,0 +1,73 @@
+// SPDX License Identifier: MIT
+package cmdline
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/jynik/skullsup/go/src/color"
+	"github.com/jynik/skullsup/go/src/psalm"
+)
+
+// Draw a sequence of incantations and colors from a generator
+func draw(rng *rand.Rand) ([][]string, []color.Color) {
+	var incantations [][]string
+	var colors []color.Color
+
+	for i := 0; i < 32; i++ {
+		incantations = append(incantations, psalm.Random(rng, ""))
+		incantations = append(incantations, psalm.Random(rng, "vortex"))
+		colors = append(colors, color.Random(rng, 16, 256))
+	}
+
+	return incantations, colors
+}
+
+func TestNewRandReproducible(t *testing.T) {
+	for _, seed := range []int64{1, 42, -7, 1 << 40} {
+		rng, used := NewRand(seed)
+		if used != seed {
+			t.Errorf("Expected seed %d to be used, got %d", seed, used)
+		}
+		incantations, colors := draw(rng)
+
+		rng, _ = NewRand(seed)
+		replayedIncantations, replayedColors := draw(rng)
+
+		if !reflect.DeepEqual(incantations, replayedIncantations) {
+			t.Errorf("Seed %d produced different incantations", seed)
+		}
+		if !reflect.DeepEqual(colors, replayedColors) {
+			t.Errorf("Seed %d produced different colors", seed)
+		}
+	}
+}
+
+func TestNewRandReportsTimeSeed(t *testing.T) {
+	rng, seed := NewRand(0)
+	if seed == 0 {
+		t.Fatal("Expected a time-based seed to be reported")
+	}
+	incantations, colors := draw(rng)
+
+	// The reported seed reproduces the output, as when passed via -seed
+	rng, _ = NewRand(seed)
+	replayedIncantations, replayedColors := draw(rng)
+
+	if !reflect.DeepEqual(incantations, replayedIncantations) || !reflect.DeepEqual(colors, replayedColors) {
+		t.Errorf("Reported seed %d did not reproduce the output", seed)
+	}
+}
+
+func TestNewRandSeedsDiffer(t *testing.T) {
+	a, _ := NewRand(1)
+	b, _ := NewRand(2)
+
+	incantationsA, colorsA := draw(a)
+	incantationsB, colorsB := draw(b)
+
+	if reflect.DeepEqual(incantationsA, incantationsB) && reflect.DeepEqual(colorsA, colorsB) {
+		t.Error("Different seeds produced identical output")
+	}
+}
@@ -1,18 +1,34 @@
 // SPDX License Identifier: MIT
 package cmdline
 
-import "flag"
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/jynik/skullsup/go/src/network"
+)
 
 type WriterFlags struct {
 	Cfg string
 
 	Queue  string
 	Period int
+
+	TTL     time.Duration
+	Expires string
+	At      string
+
+	Priority int
 }
 
 const cfgHelp = "Load the specified configuration file."
 const queueHelp = "Write the the specified queue."
 const periodHelp = "Intra-frame period, in ms."
+const ttlHelp = "Discard the command if it is not delivered within the specified duration (e.g., 8h)."
+const expiresHelp = "Discard the command if it is not delivered by the specified time."
+const priorityHelp = "Deliver the command ahead of those with a lower priority, from 0 to 9."
+const atHelp = "Do not deliver the command before the specified time (e.g., 23:59 or 2026-10-31T23:59:00-04:00)."
 
 func (f *WriterFlags) Init() {
 	flag.StringVar(&f.Cfg, "cfg", "", cfgHelp)
@@ -22,9 +38,74 @@ func (f *WriterFlags) Init() {
 	if f.Period >= 0 {
 		flag.IntVar(&f.Period, "period", -1, periodHelp)
 	}
+
+	flag.DurationVar(&f.TTL, "ttl", 0, ttlHelp)
+	flag.StringVar(&f.Expires, "expires", "", expiresHelp)
+	flag.StringVar(&f.At, "at", "", atHelp)
+	flag.IntVar(&f.Priority, "priority", 0, priorityHelp)
 }
 
 func (f *WriterFlags) LocalInit() {
 	flag.StringVar(&f.Cfg, "cfg", "", cfgHelp)
 	flag.IntVar(&f.Period, "period", -1, periodHelp)
 }
+
+// Parse a time as RFC 3339, "YYYY-MM-DD hh:mm", or "hh:mm". In the latter
+// case, the next occurrence of that time of day is returned.
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	} else if t, err := time.ParseInLocation("2006-01-02 15:04", s, now.Location()); err == nil {
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation("15:04", s, now.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid time: %s", s)
+	}
+
+	t = time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+	if !t.After(now) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// Apply the priority, expiry, and scheduled delivery time options to a message
+func (f *WriterFlags) Apply(msg *network.Message) error {
+	now := time.Now()
+
+	if f.Priority < 0 || f.Priority > network.MaxPriority {
+		return fmt.Errorf("Priority must be in the range [0, %d]", network.MaxPriority)
+	}
+	msg.Priority = f.Priority
+
+	if f.TTL < 0 {
+		return fmt.Errorf("Invalid TTL: %s", f.TTL)
+	} else if f.TTL > 0 {
+		// The server determines the expiry time, in case our clocks differ
+		msg.TTL = int((f.TTL + time.Second - 1) / time.Second)
+	}
+
+	if f.Expires != "" {
+		if f.TTL > 0 {
+			return fmt.Errorf("Only one of -ttl or -expires may be specified")
+		}
+
+		expiry, err := ParseTime(f.Expires, now)
+		if err != nil {
+			return err
+		}
+		msg.ExpiresAt = &expiry
+	}
+
+	if f.At != "" {
+		at, err := ParseTime(f.At, now)
+		if err != nil {
+			return err
+		}
+		msg.NotBefore = &at
+	}
+
+	return nil
+}
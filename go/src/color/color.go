@@ -2,26 +2,16 @@
 package color
 
 import (
-	"encoding/hex"
 	"fmt"
 	"math/rand"
-	"strings"
 )
 
 type Color struct {
 	Red, Green, Blue uint8
 }
 
-func New(s string) (Color, error) {
-	s = strings.TrimSpace(s)
-	if b, err := hex.DecodeString(s); err != nil || len(b) != 3 {
-		return Color{}, fmt.Errorf("Invalid color: %s", s)
-	} else {
-		return Color{b[0], b[1], b[2]}, nil
-	}
-}
-
-func Random(lumaMin, lumaMax int) Color {
+// Generate a random color with a luma in the specified range
+func Random(rng *rand.Rand, lumaMin, lumaMax int) Color {
 	if lumaMax < 0 {
 		lumaMax = 0
 	} else if lumaMax > 256 {
@@ -36,9 +26,12 @@ func Random(lumaMin, lumaMax int) Color {
 		lumaMin = lumaMax
 	}
 
-	y := float32(rand.Intn(lumaMax-lumaMin) + lumaMin)
-	u := float32(rand.Intn(256))
-	v := float32(rand.Intn(256))
+	y := float32(lumaMin)
+	if lumaMax > lumaMin {
+		y += float32(rng.Intn(lumaMax - lumaMin))
+	}
+	u := float32(rng.Intn(256))
+	v := float32(rng.Intn(256))
 
 	r := 1.164*(y-16) + 1.596*(v-128)
 	if r > 255 {
@@ -0,0 +1,70 @@
+// SPDX License Identifier: MIT
+package color
+
+import "sort"
+
+// A color at a position along a gradient
+type Stop struct {
+	Position float64 // Position along the gradient, in [0, 1]
+	Color    Color
+}
+
+// Multi-stop color gradient
+type Gradient []Stop
+
+// Create a gradient from evenly spaced colors
+func NewGradient(colors ...Color) Gradient {
+	g := make(Gradient, len(colors))
+	for i, c := range colors {
+		if len(colors) > 1 {
+			g[i].Position = float64(i) / float64(len(colors)-1)
+		}
+		g[i].Color = c
+	}
+	return g
+}
+
+// Create a gradient from stops at arbitrary positions
+func NewGradientFromStops(stops ...Stop) Gradient {
+	g := append(Gradient{}, stops...)
+	sort.SliceStable(g, func(i, j int) bool {
+		return g[i].Position < g[j].Position
+	})
+	return g
+}
+
+// Sample the gradient at the specified position. Positions before the
+// first stop or after the last stop yield the color of that stop.
+func (g Gradient) At(pos float64) Color {
+	if len(g) == 0 {
+		return Color{}
+	} else if pos <= g[0].Position {
+		return g[0].Color
+	}
+
+	for i := 1; i < len(g); i++ {
+		if pos <= g[i].Position {
+			prev := g[i-1]
+			span := g[i].Position - prev.Position
+			if span <= 0 {
+				return g[i].Color
+			}
+			return prev.Color.LerpGamma(g[i].Color, (pos-prev.Position)/span)
+		}
+	}
+
+	return g[len(g)-1].Color
+}
+
+// Sample n evenly spaced colors from the gradient, including its endpoints
+func (g Gradient) Sample(n int) []Color {
+	ret := make([]Color, n)
+	for i := range ret {
+		pos := 0.0
+		if n > 1 {
+			pos = float64(i) / float64(n-1)
+		}
+		ret[i] = g.At(pos)
+	}
+	return ret
+}
@@ -0,0 +1,115 @@
+// SPDX License Identifier: MIT
+package color
+
+import "math"
+
+// Convert a value in [0, 1] to a color component, clamping as needed
+func toComponent(x float64) uint8 {
+	x = x*255.0 + 0.5
+	if x > 255.0 {
+		return 255
+	} else if x < 0 {
+		return 0
+	}
+	return uint8(x)
+}
+
+func clampUnit(x float64) float64 {
+	return math.Max(0, math.Min(1, x))
+}
+
+// Normalize a hue, in degrees, to [0, 360)
+func normalizeHue(h float64) float64 {
+	h = math.Mod(h, 360)
+	if h < 0 {
+		h += 360
+	}
+	return h
+}
+
+// Create a color from a hue in degrees, and a saturation and value in [0, 1]
+func FromHSV(h, s, v float64) Color {
+	h = normalizeHue(h)
+	s = clampUnit(s)
+	v = clampUnit(v)
+
+	c := v * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := v - c
+
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = c, x, 0
+	case h < 120:
+		r, g, b = x, c, 0
+	case h < 180:
+		r, g, b = 0, c, x
+	case h < 240:
+		r, g, b = 0, x, c
+	case h < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+
+	return Color{toComponent(r + m), toComponent(g + m), toComponent(b + m)}
+}
+
+// Create a color from a hue in degrees, and a saturation and lightness in [0, 1]
+func FromHSL(h, s, l float64) Color {
+	s = clampUnit(s)
+	l = clampUnit(l)
+
+	v := l + s*math.Min(l, 1-l)
+	if v == 0 {
+		return FromHSV(h, 0, 0)
+	}
+	return FromHSV(h, 2*(1-l/v), v)
+}
+
+// Returns the color's hue in degrees, and its saturation and value in [0, 1]
+func (c Color) HSV() (h, s, v float64) {
+	r := float64(c.Red) / 255.0
+	g := float64(c.Green) / 255.0
+	b := float64(c.Blue) / 255.0
+
+	max := math.Max(r, math.Max(g, b))
+	min := math.Min(r, math.Min(g, b))
+	delta := max - min
+
+	switch {
+	case delta == 0:
+		h = 0
+	case max == r:
+		h = 60 * math.Mod((g-b)/delta, 6)
+	case max == g:
+		h = 60 * ((b-r)/delta + 2)
+	default:
+		h = 60 * ((r-g)/delta + 4)
+	}
+
+	if max != 0 {
+		s = delta / max
+	}
+
+	return normalizeHue(h), s, max
+}
+
+// Returns the color's hue in degrees, and its saturation and lightness in [0, 1]
+func (c Color) HSL() (h, s, l float64) {
+	h, sv, v := c.HSV()
+
+	l = v * (1 - sv/2)
+	if l != 0 && l != 1 {
+		s = (v - l) / math.Min(l, 1-l)
+	}
+
+	return h, s, l
+}
+
+// Returns the color with its hue rotated by the specified number of degrees
+func (c Color) RotateHue(degrees float64) Color {
+	h, s, v := c.HSV()
+	return FromHSV(h+degrees, s, v)
+}
@@ -0,0 +1,53 @@
+// SPDX License Identifier: MIT
+package color
+
+import "math"
+
+// Returns the color in the OKLab color space, where L is the perceived
+// lightness in [0, 1], and a and b are the green-red and blue-yellow axes.
+func (c Color) OKLab() (L, a, b float64) {
+	r, g, bl := linearize(c.Red), linearize(c.Green), linearize(c.Blue)
+
+	l := math.Cbrt(0.4122214708*r + 0.5363325363*g + 0.0514459929*bl)
+	m := math.Cbrt(0.2119034982*r + 0.6806995451*g + 0.1073969566*bl)
+	s := math.Cbrt(0.0883024619*r + 0.2817188376*g + 0.6299787005*bl)
+
+	L = 0.2104542553*l + 0.7936177850*m - 0.0040720468*s
+	a = 1.9779984951*l - 2.4285922050*m + 0.4505937099*s
+	b = 0.0259040371*l + 0.7827717662*m - 0.8086757660*s
+	return
+}
+
+// Create a color from OKLab coordinates. The returned boolean is false
+// if the coordinates are outside of the sRGB gamut, in which case the
+// returned color has been clamped.
+func FromOKLab(L, a, b float64) (Color, bool) {
+	l := L + 0.3963377774*a + 0.2158037573*b
+	m := L - 0.1055613458*a - 0.0638541728*b
+	s := L - 0.0894841775*a - 1.2914855480*b
+
+	l, m, s = l*l*l, m*m*m, s*s*s
+
+	r := +4.0767416621*l - 3.3077115913*m + 0.2309699292*s
+	g := -1.2684380046*l + 2.6097574011*m - 0.3413193965*s
+	bl := -0.0041960863*l - 0.7034186147*m + 1.7076147010*s
+
+	const eps = 1e-4
+	inGamut := true
+	for _, x := range []float64{r, g, bl} {
+		if x < -eps || x > 1+eps {
+			inGamut = false
+		}
+	}
+
+	return Color{delinearize(r), delinearize(g), delinearize(bl)}, inGamut
+}
+
+// Returns the perceptual difference between two colors, computed as the
+// Euclidean distance between them in OKLab. A value of ~0.02 is a just
+// noticeable difference, and black and white are 1.0 apart.
+func Distance(x, y Color) float64 {
+	L1, a1, b1 := x.OKLab()
+	L2, a2, b2 := y.OKLab()
+	return math.Sqrt((L1-L2)*(L1-L2) + (a1-a2)*(a1-a2) + (b1-b2)*(b1-b2))
+}
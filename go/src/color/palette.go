@@ -0,0 +1,113 @@
+// SPDX License Identifier: MIT
+package color
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/jynik/skullsup/go/src/file"
+)
+
+// A named collection of colors
+type Palette struct {
+	Name   string
+	Colors []Color
+}
+
+// Built-in palettes
+var Palettes []Palette = []Palette{
+	{
+		Name: "fire",
+		Colors: []Color{
+			{0x33, 0x00, 0x00}, {0x80, 0x00, 0x00}, {0xcc, 0x22, 0x00},
+			{0xff, 0x45, 0x00}, {0xff, 0x8c, 0x00}, {0xff, 0xb0, 0x00},
+		},
+	},
+
+	{
+		Name: "ocean",
+		Colors: []Color{
+			{0x00, 0x00, 0x33}, {0x00, 0x1f, 0x5c}, {0x00, 0x40, 0x80},
+			{0x00, 0x77, 0xbe}, {0x00, 0xa6, 0xc8}, {0x40, 0xe0, 0xd0},
+		},
+	},
+
+	{
+		Name: "hellish",
+		Colors: []Color{
+			{0x1a, 0x00, 0x00}, {0x8b, 0x00, 0x00}, {0xff, 0x00, 0x00},
+			{0xff, 0x45, 0x00}, {0x80, 0x00, 0x80}, {0x2e, 0x08, 0x54},
+		},
+	},
+}
+
+// Look up a palette by name, first searching the provided palettes
+// and then the built-in palettes.
+func LookupPalette(name string, palettes ...Palette) (*Palette, error) {
+	name = strings.ToLower(name)
+
+	for _, list := range [][]Palette{palettes, Palettes} {
+		for i := range list {
+			if strings.ToLower(list[i].Name) == name {
+				return &list[i], nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("No such palette: %s", name)
+}
+
+// Load palettes from a file containing a JSON list of objects in the form:
+//	{ "name": "<name>", "colors": [ "<color>", ... ] }
+//
+// Colors may be specified in any format accepted by New().
+func LoadPalettes(filename string) ([]Palette, error) {
+	var entries []struct {
+		Name   string   `json:"name"`
+		Colors []string `json:"colors"`
+	}
+
+	data, err := file.FindAndRead(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("Failed to parse palette file: %s", err)
+	}
+
+	palettes := make([]Palette, len(entries))
+	for i, entry := range entries {
+		if entry.Name == "" {
+			return nil, fmt.Errorf("Palette %d is missing a name", i)
+		} else if len(entry.Colors) == 0 {
+			return nil, fmt.Errorf("Palette \"%s\" has no colors", entry.Name)
+		}
+
+		palettes[i].Name = entry.Name
+		for _, s := range entry.Colors {
+			c, err := New(s)
+			if err != nil {
+				return nil, fmt.Errorf("Palette \"%s\": %s", entry.Name, err)
+			}
+			palettes[i].Colors = append(palettes[i].Colors, c)
+		}
+	}
+
+	return palettes, nil
+}
+
+// Choose a random color from the palette. Black is returned for an empty palette.
+func (p *Palette) Random(rng *rand.Rand) Color {
+	if len(p.Colors) == 0 {
+		return Color{}
+	}
+	return p.Colors[rng.Intn(len(p.Colors))]
+}
+
+// Returns a gradient through each of the palette's colors
+func (p *Palette) Gradient() Gradient {
+	return NewGradient(p.Colors...)
+}
@@ -0,0 +1,134 @@
+// SPDX License Identifier: MIT
+package color
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func parseHex(s string) (Color, bool) {
+	// Expand #rgb to #rrggbb
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+
+	if b, err := hex.DecodeString(s); err != nil || len(b) != 3 {
+		return Color{}, false
+	} else {
+		return Color{b[0], b[1], b[2]}, true
+	}
+}
+
+// Parse a number, optionally suffixed with a '%', and scale it to [0, 1]
+// using the provided maximum for non-percentage values.
+func parseUnit(s string, max float64) (float64, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(s, "%") {
+		max = 100
+		s = strings.TrimSpace(s[:len(s)-1])
+	}
+
+	x, err := strconv.ParseFloat(s, 64)
+	if err != nil || x < 0 || x > max {
+		return 0, fmt.Errorf("Invalid color component: %s", s)
+	}
+	return x / max, nil
+}
+
+func parseHue(s string) (float64, error) {
+	s = strings.TrimSuffix(strings.TrimSpace(s), "deg")
+	h, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid hue: %s", s)
+	}
+	return h, nil
+}
+
+// Parse a "name(a, b, c)" color function. Returns the function name
+// and its three arguments.
+func parseFunc(s string) (string, []string, bool) {
+	open := strings.IndexByte(s, '(')
+	if open < 0 || !strings.HasSuffix(s, ")") {
+		return "", nil, false
+	}
+
+	args := strings.Split(s[open+1:len(s)-1], ",")
+	if len(args) != 3 {
+		return "", nil, false
+	}
+
+	return strings.TrimSpace(s[:open]), args, true
+}
+
+func parseFuncColor(name string, args []string) (Color, error) {
+	var x [3]float64
+	var err error
+
+	switch name {
+	case "rgb":
+		for i := range args {
+			if x[i], err = parseUnit(args[i], 255); err != nil {
+				return Color{}, err
+			}
+		}
+		return Color{toComponent(x[0]), toComponent(x[1]), toComponent(x[2])}, nil
+
+	case "hsv", "hsl":
+		if x[0], err = parseHue(args[0]); err != nil {
+			return Color{}, err
+		}
+
+		// As in scripts, unitless values are fractions in [0, 1]
+		for i := 1; i < len(args); i++ {
+			if x[i], err = parseUnit(args[i], 1); err != nil {
+				return Color{}, err
+			}
+		}
+
+		if name == "hsv" {
+			return FromHSV(x[0], x[1], x[2]), nil
+		}
+		return FromHSL(x[0], x[1], x[2]), nil
+	}
+
+	return Color{}, fmt.Errorf("Invalid color function: %s", name)
+}
+
+// Create a color from a string in one of the following formats:
+//
+//	rrggbb, #rrggbb, #rgb   Hexadecimal RGB values
+//	rgb(r, g, b)            Components in [0, 255], or as percentages
+//	hsv(h, s, v)            Hue in degrees. Saturation and value in [0, 1], or as percentages.
+//	hsl(h, s, l)            Hue in degrees. Saturation and lightness in [0, 1], or as percentages.
+//	<name>                  CSS color name (e.g., "rebeccapurple")
+//
+// Color names and functions are case-insensitive.
+func New(str string) (Color, error) {
+	s := strings.ToLower(strings.TrimSpace(str))
+
+	if c, ok := names[s]; ok {
+		return c, nil
+	}
+
+	if strings.HasPrefix(s, "#") && (len(s) == 4 || len(s) == 7) {
+		if c, ok := parseHex(s[1:]); ok {
+			return c, nil
+		}
+	} else if len(s) == 6 {
+		if c, ok := parseHex(s); ok {
+			return c, nil
+		}
+	}
+
+	if name, args, ok := parseFunc(s); ok {
+		if c, err := parseFuncColor(name, args); err != nil {
+			return Color{}, fmt.Errorf("Invalid color: %s (%s)", str, err)
+		} else {
+			return c, nil
+		}
+	}
+
+	return Color{}, fmt.Errorf("Invalid color: %s", str)
+}
@@ -0,0 +1,80 @@
+// SPDX License Identifier: MIT
+package color
+
+import "testing"
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string // Expected color, or "" if the string is invalid
+	}{
+		// Hexadecimal
+		{"ff8000", "ff8000"},
+		{"FF8000", "ff8000"},
+		{"#ff8000", "ff8000"},
+		{"#f80", "ff8800"},
+		{" #F80 ", "ff8800"},
+		{"f80", ""},
+		{"#ff80", ""},
+		{"#ff800", ""},
+		{"ff800g", ""},
+		{"#ggg", ""},
+
+		// Names
+		{"red", "ff0000"},
+		{"RebeccaPurple", "663399"},
+		{"black", "000000"},
+		{"notacolor", ""},
+
+		// rgb()
+		{"rgb(255, 128, 0)", "ff8000"},
+		{"RGB(255,128,0)", "ff8000"},
+		{"rgb(100%, 50%, 0%)", "ff8000"},
+		{"rgb(256, 0, 0)", ""},
+		{"rgb(-1, 0, 0)", ""},
+		{"rgb(101%, 0, 0)", ""},
+		{"rgb(1, 2)", ""},
+		{"rgb(1, 2, 3, 4)", ""},
+		{"rgb(a, b, c)", ""},
+		{"rgb(1, 2, 3", ""},
+
+		// hsv(), with unitless values in [0, 1], as in scripts
+		{"hsv(0, 1, 1)", "ff0000"},
+		{"hsv(0, 100%, 100%)", "ff0000"},
+		{"hsv(120, 1, 1)", "00ff00"},
+		{"hsv(240deg, 1, 1)", "0000ff"},
+		{"hsv(360, 1, 1)", "ff0000"},
+		{"hsv(-120, 1, 1)", "0000ff"},
+		{"hsv(0, 0, 0.5)", "808080"},
+		{"hsv(0, 0%, 50%)", "808080"},
+		{"hsv(0, 1, 0)", "000000"},
+		{"hsv(0, 100, 5)", ""},
+		{"hsv(0, 1.5, 1)", ""},
+		{"hsv(0, 101%, 1)", ""},
+		{"hsv(x, 1, 1)", ""},
+
+		// hsl()
+		{"hsl(0, 1, 0.5)", "ff0000"},
+		{"hsl(120, 100%, 50%)", "00ff00"},
+		{"hsl(0, 0, 1)", "ffffff"},
+		{"hsl(0, 0, 0)", "000000"},
+		{"hsl(0, 100, 50)", ""},
+
+		{"cmyk(0, 0, 0)", ""},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		c, err := New(test.in)
+
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %s", test.in, c)
+			}
+		} else if err != nil {
+			t.Errorf("%q: %s", test.in, err)
+		} else if c.String() != test.want {
+			t.Errorf("%q: expected %s, got %s", test.in, test.want, c)
+		}
+	}
+}
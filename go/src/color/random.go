@@ -0,0 +1,122 @@
+// SPDX License Identifier: MIT
+package color
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Constraints on randomly generated colors. Each value is in [0, 1].
+//
+// For HSV-based generation, these directly constrain the saturation and
+// value. For OKLab-based generation, brightness constrains the perceived
+// lightness and saturation constrains the chroma, relative to MaxChroma.
+type Constraints struct {
+	MinSaturation, MaxSaturation float64
+	MinBrightness, MaxBrightness float64
+}
+
+// Unconstrained generation of random colors
+var AnyColor = Constraints{0, 1, 0, 1}
+
+// Approximate maximum chroma of an sRGB color in OKLab
+const MaxChroma = 0.32
+
+// Number of attempts made to find an in-gamut OKLab color
+const oklabAttempts = 32
+
+func uniform(rng *rand.Rand, min, max float64) float64 {
+	min, max = clampUnit(min), clampUnit(max)
+	if max <= min {
+		return min
+	}
+	return min + rng.Float64()*(max-min)
+}
+
+// Generate a random color with a uniformly distributed hue, and
+// saturation and value within the specified constraints.
+func RandomHSV(rng *rand.Rand, c Constraints) Color {
+	h := rng.Float64() * 360
+	s := uniform(rng, c.MinSaturation, c.MaxSaturation)
+	v := uniform(rng, c.MinBrightness, c.MaxBrightness)
+	return FromHSV(h, s, v)
+}
+
+// Generate a random color with a uniformly distributed hue in OKLab, such
+// that colors of a given lightness and chroma appear equally bright and
+// vivid. Colors outside of the sRGB gamut are rejected, rather than clipped.
+func RandomOKLab(rng *rand.Rand, c Constraints) Color {
+	var ret Color
+
+	for i := 0; i < oklabAttempts; i++ {
+		h := rng.Float64() * 2 * math.Pi
+		L := uniform(rng, c.MinBrightness, c.MaxBrightness)
+		chroma := uniform(rng, c.MinSaturation, c.MaxSaturation) * MaxChroma
+
+		var inGamut bool
+		if ret, inGamut = FromOKLab(L, chroma*math.Cos(h), chroma*math.Sin(h)); inGamut {
+			break
+		}
+	}
+
+	return ret
+}
+
+// Generates random colors that are perceptually distinct from the
+// previously generated colors.
+type Distinct struct {
+	// Generator for candidate colors
+	Generate func(*rand.Rand) Color
+
+	// Number of previous colors to remain distinct from
+	Count int
+
+	// Minimum perceptual distance from previous colors. See Distance().
+	MinDistance float64
+
+	// Previously generated colors, most recent last. This may be
+	// pre-populated to remain distinct from colors from another source.
+	History []Color
+}
+
+// Number of candidates considered by Distinct.Next()
+const distinctAttempts = 64
+
+// Distance to the closest of the colors in the history
+func (d *Distinct) closest(c Color) float64 {
+	ret := math.Inf(1)
+	for _, prev := range d.History {
+		ret = math.Min(ret, Distance(c, prev))
+	}
+	return ret
+}
+
+// Generate the next color. If a sufficiently distinct color cannot be
+// found, the most distinct of the candidates is returned.
+func (d *Distinct) Next(rng *rand.Rand) Color {
+	var best Color
+	bestDistance := -1.0
+
+	if len(d.History) > d.Count {
+		d.History = d.History[len(d.History)-d.Count:]
+	}
+
+	for i := 0; i < distinctAttempts; i++ {
+		c := d.Generate(rng)
+		dist := d.closest(c)
+		if dist > bestDistance {
+			best, bestDistance = c, dist
+		}
+
+		if dist >= d.MinDistance {
+			break
+		}
+	}
+
+	d.History = append(d.History, best)
+	if len(d.History) > d.Count {
+		d.History = d.History[len(d.History)-d.Count:]
+	}
+
+	return best
+}
@@ -1,20 +1,44 @@
 // SPDX License Identifier: MIT
 package device
 
+import (
+	"github.com/jynik/skullsup/go/src/frame"
+	"github.com/jynik/skullsup/go/src/psalm"
+)
+
 type fwVersion struct {
 	major uint // Major version - non-backwards compatible changes
 	minor uint // Minor version - added features, backwards compatible
 	patch uint // Patch version - bug fixes and non-functional changes
 }
 
+// Is the firmware version at least the specified major and minor version?
+func (v fwVersion) atLeast(major, minor uint) bool {
+	return v.major > major || (v.major == major && v.minor >= minor)
+}
+
+// Can the device play its frames once and then hold the final frame?
+func (p *platform) canPlayOnce() bool {
+	return p.fw.atLeast(0, 4)
+}
+
 type platform struct {
 	maxFrames uint
 	numStrips uint
 	stripLen  uint
+	ledLayout uint8
 	ledCount  uint
 	fw        fwVersion
 }
 
+func (p *platform) layout() frame.Layout {
+	return frame.Layout{NumStrips: p.numStrips, StripLen: p.stripLen, Flags: p.ledLayout}
+}
+
+func (p *platform) psalmDevice() psalm.Device {
+	return psalm.Device{LedCount: p.ledCount, Layout: p.layout(), MaxFrames: p.maxFrames}
+}
+
 func (s *Skull) loadPlatformInfo() error {
 	var err error
 	var buf []byte
@@ -62,6 +86,16 @@ func (s *Skull) loadPlatformInfo() error {
 	}
 	s.plat.stripLen = uint(buf[0])
 
+	cmd[0] = CmdLayout
+	if _, err := s.dev.write(cmd, true); err != nil {
+		return err
+	}
+
+	if buf, err = s.dev.read(1); err != nil {
+		return err
+	}
+	s.plat.ledLayout = buf[0]
+
 	s.plat.ledCount = s.plat.numStrips * s.plat.stripLen
 
 	return nil
@@ -3,6 +3,7 @@ package device
 
 import (
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 
@@ -28,6 +29,10 @@ const (
 type Skull struct {
 	dev  device   // Device handle
 	plat platform // Platform attributes
+
+	onSegmented func() // Called before playing a segmented animation
+
+	sleep func(time.Duration) // Waits for segments to be played
 }
 
 const (
@@ -66,6 +71,10 @@ const (
 
 	// Addresses all LEDs when loading a frame. 0x3e - 0x00 address single LEDs
 	ALL_LEDS = 0x3f
+
+	// CmdReanimate flag: play the frames once, then hold the final frame.
+	// Supported by firmware 0.4.0 and later.
+	ReanimateOnce = 0x01
 )
 
 // Error messages
@@ -76,8 +85,38 @@ const (
 
 	// Command timed out
 	ErrorTimeout = "Our cries have gone unanswered and we've given up."
+
+	// Animation does not fit in the device's frame buffer
+	ErrorTooManyFrames = "This ritual requires %d frames, but the vessel can only bear %d."
+
+	// Animation must be played in segments, which the firmware cannot do
+	ErrorNoSegments = "This ritual requires %d frames, but the vessel can only bear %d. Firmware 0.4.0 or later is needed to play it in parts."
 )
 
+// Failure to communicate with the device. Unlike errors caused by invalid
+// colors, frames or psalms, these may not recur if the command is retried.
+type IOError struct {
+	Err error
+}
+
+func (e *IOError) Error() string {
+	return e.Err.Error()
+}
+
+// Returns true if the error was caused by a failure to communicate with the
+// device, rather than by the command itself
+func IsIOError(err error) bool {
+	_, ok := err.(*IOError)
+	return ok
+}
+
+func ioError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &IOError{err}
+}
+
 // Return a checksum for a payload sent to a device
 func checksum(payload []byte) byte {
 	ret := byte(0)
@@ -91,6 +130,7 @@ func New(name string) (*Skull, error) {
 	var err error
 
 	s := new(Skull)
+	s.sleep = time.Sleep
 
 	if name == "hexdump" {
 		s.dev, err = openHexDumper(name)
@@ -113,6 +153,14 @@ func New(name string) (*Skull, error) {
 	return s, err
 }
 
+// Register a function to be called once an animation too long for the
+// device's frame buffer has been validated, before blocking during its
+// playback. This allows callers to release resources, such as queued
+// messages, that would otherwise be held for the duration of the animation.
+func (s *Skull) OnSegmented(fn func()) {
+	s.onSegmented = fn
+}
+
 // Ensure the device is ready to accept commands by sending the summon command
 // and ensuring that we've gotten a valid ACK.
 func (s *Skull) summon() error {
@@ -132,7 +180,7 @@ func (s *Skull) summon() error {
 		err = errors.New(ErrorTimeout)
 	}
 
-	return err
+	return ioError(err)
 }
 
 func (s *Skull) setColor(c color.Color) error {
@@ -140,7 +188,7 @@ func (s *Skull) setColor(c color.Color) error {
 		return err
 	}
 	_, err := s.dev.write([]byte{CmdSetColor, c.Red, c.Green, c.Blue}, true)
-	return err
+	return ioError(err)
 }
 
 func (s *Skull) SetColor(colorStr string) error {
@@ -157,10 +205,15 @@ func (s *Skull) loadFrame(f frame.Frame) error {
 		cmd |= NoFrameDelay
 	}
 	_, err := s.dev.write([]byte{cmd, f.Color.Red, f.Color.Green, f.Color.Blue}, true)
-	return err
+	return ioError(err)
 }
 
 func (s *Skull) loadFrames(frames []frame.Frame) error {
+	frames = frame.Expand(frame.Optimize(frames, s.plat.ledCount))
+	if uint(len(frames)) > s.plat.maxFrames {
+		return fmt.Errorf(ErrorTooManyFrames, len(frames), s.plat.maxFrames)
+	}
+
 	for _, f := range frames {
 		if err := s.loadFrame(f); err != nil {
 			return err
@@ -169,11 +222,11 @@ func (s *Skull) loadFrames(frames []frame.Frame) error {
 	return nil
 }
 
-func (s *Skull) reanimate(period uint16) error {
+func (s *Skull) reanimate(period uint16, flags uint8) error {
 	var msb uint8 = uint8(period >> 8)
 	var lsb uint8 = uint8(period & 0xff)
-	_, err := s.dev.write([]byte{CmdReanimate, msb, lsb, 0x00}, true)
-	return err
+	_, err := s.dev.write([]byte{CmdReanimate, msb, lsb, flags}, true)
+	return ioError(err)
 }
 
 func (s *Skull) Reanimate(frameStrs []string, period uint16) error {
@@ -187,10 +240,10 @@ func (s *Skull) Reanimate(frameStrs []string, period uint16) error {
 
 	frames := []frame.Frame{}
 	for _, frameStr := range frameStrs {
-		if f, err := frame.New(frameStr); err != nil {
+		if f, err := frame.Parse(frameStr, s.plat.layout()); err != nil {
 			return err
 		} else {
-			frames = append(frames, f)
+			frames = append(frames, f...)
 		}
 	}
 
@@ -198,28 +251,98 @@ func (s *Skull) Reanimate(frameStrs []string, period uint16) error {
 		return err
 	}
 
-	return s.reanimate(period)
+	return s.reanimate(period, 0)
 }
 
 func (s *Skull) Incant(psalmName string, args []string, period uint16) error {
-	frames, defaultPeriod, err := psalm.Lookup(psalmName, args, s.plat.ledCount)
+	p := psalm.Find(psalmName)
+	if p == nil {
+		// Composite expressions, e.g., "seq(pulse, vortex)"
+		frames, period, err := psalm.Lookup(psalmName, args, period, s.plat.psalmDevice())
+		if err != nil {
+			return err
+		}
+		return s.incant(frames, period)
+	}
+
+	return s.IncantPsalm(p, args, period)
+}
+
+// Incant a psalm that is not registered, such as one loaded from a script
+func (s *Skull) IncantPsalm(p *psalm.Psalm, args []string, period uint16) error {
+	frames, period, err := p.Generate(args, period, s.plat.psalmDevice())
 	if err != nil {
 		return err
 	}
 
-	if period == 0 {
-		period = defaultPeriod
+	if p.Split {
+		return s.incantSegments(frames, period)
 	}
 
+	return s.incant(frames, period)
+}
+
+// Incant an animation that may not fit in the device's frame buffer. If it
+// does not, it is uploaded in segments that are each played once, after
+// which the final state of the LEDs is held.
+//
+// This blocks until the animation has been played. See OnSegmented().
+func (s *Skull) incantSegments(frames []frame.Frame, period uint16) error {
+	frames = frame.Expand(frame.Optimize(frames, s.plat.ledCount))
+	if uint(len(frames)) <= s.plat.maxFrames {
+		return s.incant(frames, period)
+	} else if !s.plat.canPlayOnce() {
+		return fmt.Errorf(ErrorNoSegments, len(frames), s.plat.maxFrames)
+	}
+
+	segments, err := frame.Split(frames, s.plat.maxFrames)
+	if err != nil {
+		return err
+	}
+
+	if s.onSegmented != nil {
+		s.onSegmented()
+	}
+
+	for i, segment := range segments {
+		if err := s.play(segment, period, ReanimateOnce); err != nil {
+			return err
+		}
+
+		// The device holds the final frame once it has played the segment,
+		// so there is no need to wait for the last one.
+		if i < len(segments)-1 {
+			s.sleep(segmentDuration(segment, period))
+		}
+	}
+
+	return nil
+}
+
+// Time to wait for a segment to be played once. The device holds the
+// segment's final frame when it is done, so it is better to wait too long
+// than to summon the device early and cut the segment short. A margin
+// accounts for the difference between the host and device clocks.
+func segmentDuration(segment []frame.Frame, period uint16) time.Duration {
+	d := time.Duration(frame.Periods(segment)) * time.Duration(period) * time.Millisecond
+	return d + d/50 + 10*time.Millisecond
+}
+
+func (s *Skull) incant(frames []frame.Frame, period uint16) error {
+	return s.play(frames, period, 0)
+}
+
+// Upload frames and reanimate the device, with the specified CmdReanimate flags
+func (s *Skull) play(frames []frame.Frame, period uint16, flags uint8) error {
 	if err := s.summon(); err != nil {
 		return err
 	}
 
-	if err = s.loadFrames(frames); err != nil {
+	if err := s.loadFrames(frames); err != nil {
 		return err
 	}
 
-	return s.reanimate(period)
+	return s.reanimate(period, flags)
 }
 
 func (s *Skull) Close() error {
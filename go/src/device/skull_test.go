@@ -0,0 +1,220 @@
+// SPDX License Identifier: MIT
+package device
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jynik/skullsup/go/src/color"
+	"github.com/jynik/skullsup/go/src/frame"
+	"github.com/jynik/skullsup/go/src/psalm"
+)
+
+// Simulates the firmware's handling of frames, using a virtual clock that
+// is advanced by the host's writes and sleeps.
+type fakeDevice struct {
+	now     time.Duration // Host time
+	latency time.Duration // Time taken by each write
+	drift   float64       // Fraction by which the device's clock runs slow
+
+	frames      []frame.Frame // Frame buffer
+	reanimated  bool
+	once        bool
+	period      time.Duration
+	start       time.Duration // Host time at which reanimation began
+	segments    int           // Number of times the device was reanimated
+	replayed    int           // Number of frames shown more than once
+	interrupted int           // Number of times playback was cut short
+
+	leds  []color.Color
+	shown [][]color.Color // LED states displayed at each delayed frame
+}
+
+func newFakeDevice(ledCount uint) *fakeDevice {
+	return &fakeDevice{latency: 4 * time.Millisecond, leds: make([]color.Color, ledCount)}
+}
+
+func (d *fakeDevice) sleep(t time.Duration) {
+	d.now += t
+}
+
+// Play the frames that were shown prior to being summoned. As in the
+// firmware, the summon sequence is read one byte per iteration of the
+// animation loop, once it has arrived.
+func (d *fakeDevice) summoned() {
+	elapsed := time.Duration(float64(d.now-d.start) / (1 + d.drift))
+	var t time.Duration
+	read := 0
+
+	for i := 0; ; {
+		if t >= elapsed {
+			if read++; read == 4 {
+				d.interrupted++
+				break
+			}
+		}
+
+		f := d.frames[i]
+		if f.Led == frame.ALL_LEDS {
+			for j := range d.leds {
+				d.leds[j] = f.Color
+			}
+		} else if int(f.Led) < len(d.leds) {
+			d.leds[f.Led] = f.Color
+		}
+
+		if f.Delay {
+			d.shown = append(d.shown, append([]color.Color{}, d.leds...))
+			t += d.period
+		}
+
+		if i++; i == len(d.frames) {
+			if d.once {
+				break
+			}
+			i = 0
+			d.replayed++
+		}
+	}
+
+	d.reanimated = false
+	d.frames = nil
+}
+
+func (d *fakeDevice) read(n uint) ([]byte, error) {
+	return make([]byte, n), nil
+}
+
+func (d *fakeDevice) write(b []byte, checkAck bool) (byte, error) {
+	d.now += d.latency
+
+	switch {
+	case b[0] == CmdSummon:
+		if d.reanimated {
+			d.summoned()
+		}
+
+	case b[0] == CmdReanimate:
+		d.period = time.Duration(uint16(b[1])<<8|uint16(b[2])) * time.Millisecond
+		d.once = b[3]&ReanimateOnce != 0
+		d.start = d.now
+		d.reanimated = true
+		d.segments++
+
+	case b[0] < 0x80:
+		d.frames = append(d.frames, frame.Frame{
+			Led:   b[0] &^ NoFrameDelay,
+			Color: color.Color{Red: b[1], Green: b[2], Blue: b[3]},
+			Delay: b[0]&NoFrameDelay == 0,
+		})
+	}
+
+	return checksum(b), nil
+}
+
+func (d *fakeDevice) close() error {
+	return nil
+}
+
+func newFakeSkull(d *fakeDevice, fw fwVersion) *Skull {
+	return &Skull{
+		dev: d,
+		plat: platform{
+			maxFrames: 55,
+			numStrips: 2,
+			stripLen:  uint(len(d.leds)) / 2,
+			ledCount:  uint(len(d.leds)),
+			fw:        fw,
+		},
+		sleep: d.sleep,
+	}
+}
+
+// LED states displayed when playing the frames once
+func expectedStates(frames []frame.Frame, ledCount uint) [][]color.Color {
+	d := newFakeDevice(ledCount)
+	d.frames = frame.Expand(frames)
+	d.once = true
+	d.period = time.Millisecond
+	d.now = time.Hour
+	d.summoned()
+	return d.shown
+}
+
+func TestIncantSegments(t *testing.T) {
+	p := psalm.Find("morse")
+	if p == nil {
+		t.Fatal("morse psalm is not registered")
+	}
+
+	tests := []struct {
+		drift   float64
+		latency time.Duration
+	}{
+		{0, 4 * time.Millisecond},
+		{0.01, 4 * time.Millisecond},
+		{-0.01, 4 * time.Millisecond},
+		{0.01, 0},
+	}
+
+	for _, test := range tests {
+		drift := test.drift
+		d := newFakeDevice(16)
+		d.drift = drift
+		d.latency = test.latency
+		s := newFakeSkull(d, fwVersion{0, 4, 0})
+
+		segmented := 0
+		s.OnSegmented(func() { segmented++ })
+
+		args := []string{"the quick brown fox jumps over the lazy dog"}
+		if err := s.IncantPsalm(p, args, 60); err != nil {
+			t.Fatal(err)
+		}
+
+		// Let the device finish the final segment, which it then holds
+		d.sleep(time.Hour)
+		s.summon()
+
+		frames, _, err := p.Generate(args, 60, s.plat.psalmDevice())
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := expectedStates(frames, 16)
+
+		if d.segments < 2 {
+			t.Errorf("drift=%g: Expected the animation to be segmented, got %d segment(s)", drift, d.segments)
+		} else if segmented != 1 {
+			t.Errorf("drift=%g: OnSegmented() called %d times", drift, segmented)
+		}
+
+		if d.replayed != 0 || d.interrupted != 0 {
+			t.Errorf("drift=%g: %d segments replayed and %d interrupted", drift, d.replayed, d.interrupted)
+		}
+
+		if !reflect.DeepEqual(d.shown, want) {
+			t.Errorf("drift=%g: Displayed %d states, expected %d in order", drift, len(d.shown), len(want))
+		}
+	}
+}
+
+func TestIncantSegmentsUnsupported(t *testing.T) {
+	d := newFakeDevice(16)
+	s := newFakeSkull(d, fwVersion{0, 3, 0})
+
+	err := s.IncantPsalm(psalm.Find("morse"), []string{"the quick brown fox"}, 60)
+	if err == nil || !strings.Contains(err.Error(), "Firmware 0.4.0") {
+		t.Errorf("Expected segmented playback to be rejected, got: %v", err)
+	} else if d.segments != 0 {
+		t.Error("Device was reanimated")
+	}
+
+	// Animations that fit in the frame buffer are still looped
+	if err := s.IncantPsalm(psalm.Find("morse"), []string{"e"}, 60); err != nil {
+		t.Fatal(err)
+	} else if d.segments != 1 || d.once {
+		t.Error("Expected a looping animation")
+	}
+}
@@ -0,0 +1,234 @@
+// SPDX License Identifier: MIT
+package frame
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Physical arrangement of a device's LEDs, used to resolve LED addresses.
+// A zero-valued Layout indicates that the arrangement is unknown, in which
+// case only flat LED numbers may be used.
+type Layout struct {
+	NumStrips uint  // Number of LED strips
+	StripLen  uint  // Number of LEDs per strip
+	Flags     uint8 // LAYOUT_* flags reported by the device
+}
+
+const (
+	// LED numbers alternate front-back while progressing down a strip
+	LAYOUT_ALTERNATING = 1 << 0
+
+	// Every other strip runs in the opposite direction of the one before it
+	LAYOUT_WRAP_INVERT = 1 << 1
+)
+
+// Total number of LEDs described by the layout
+func (l Layout) LedCount() uint {
+	return l.NumStrips * l.StripLen
+}
+
+func (l Layout) known() bool {
+	return l.LedCount() != 0
+}
+
+// Does the specified strip run in the opposite direction of LED numbering?
+func (l Layout) inverted(n uint) bool {
+	return l.Flags&LAYOUT_WRAP_INVERT != 0 && n%2 == 1
+}
+
+// Position of an LED along its strip, counting from the start of the strip
+// regardless of the direction in which its LEDs are numbered.
+func (l Layout) Position(led uint) uint {
+	if !l.known() {
+		return led
+	}
+
+	n, pos := led/l.StripLen, led%l.StripLen
+	if l.inverted(n) {
+		return l.StripLen - 1 - pos
+	}
+	return pos
+}
+
+// Return the LED numbers for all LEDs on the specified strip, ordered by
+// their position along the strip
+func (l Layout) strip(n uint) ([]uint8, error) {
+	if !l.known() {
+		return nil, fmt.Errorf("Strip addressing requires a known LED layout")
+	} else if n >= l.NumStrips {
+		return nil, fmt.Errorf("Invalid strip number: %d", n)
+	}
+
+	leds := make([]uint8, l.StripLen)
+	for i := range leds {
+		pos := uint(i)
+		if l.inverted(n) {
+			pos = l.StripLen - 1 - pos
+		}
+		leds[i] = uint8(n*l.StripLen + pos)
+	}
+	return leds, nil
+}
+
+// Return the LED numbers for a named group of LEDs.
+//   left  - The first half of the strips
+//   right - The second half of the strips
+func (l Layout) group(name string) ([]uint8, error) {
+	var first, last uint
+
+	if !l.known() {
+		return nil, fmt.Errorf("LED group \"%s\" requires a known LED layout", name)
+	}
+
+	half := l.NumStrips / 2
+	if half == 0 {
+		half = 1
+	}
+
+	switch name {
+	case "left":
+		first, last = 0, half
+	case "right":
+		first, last = l.NumStrips-half, l.NumStrips
+	default:
+		return nil, fmt.Errorf("Invalid LED group: %s", name)
+	}
+
+	var leds []uint8
+	for s := first; s < last; s++ {
+		strip, _ := l.strip(s)
+		leds = append(leds, strip...)
+	}
+	return leds, nil
+}
+
+func (l Layout) checkLed(n uint64) error {
+	if n >= ALL_LEDS || (l.known() && n >= uint64(l.LedCount())) {
+		return fmt.Errorf("Invalid LED number: %d", n)
+	}
+	return nil
+}
+
+// Parse a number or an inclusive range of numbers (e.g., "3" or "0-7"),
+// each of which must be less than max.
+func parseIndices(s string, max uint64) ([]uint64, error) {
+	var first, last uint64
+	var err error
+
+	bounds := strings.SplitN(s, "-", 2)
+
+	if first, err = strconv.ParseUint(bounds[0], 10, 8); err != nil {
+		return nil, fmt.Errorf("Invalid LED number: %s", s)
+	}
+
+	last = first
+	if len(bounds) == 2 {
+		if last, err = strconv.ParseUint(bounds[1], 10, 8); err != nil {
+			return nil, fmt.Errorf("Invalid LED range: %s", s)
+		} else if last < first {
+			return nil, fmt.Errorf("Invalid LED range: %s", s)
+		}
+	}
+
+	if last >= max {
+		return nil, fmt.Errorf("Invalid LED number: %d", last)
+	}
+
+	ret := make([]uint64, 0, last-first+1)
+	for i := first; i <= last; i++ {
+		ret = append(ret, i)
+	}
+	return ret, nil
+}
+
+// Is the provided address field a strip specifier, "s<n>"?
+func parseStrip(s string) (uint, bool) {
+	if len(s) < 2 || (s[0] != 's' && s[0] != 'S') {
+		return 0, false
+	}
+
+	n, err := strconv.ParseUint(s[1:], 10, 8)
+	if err != nil {
+		return 0, false
+	}
+	return uint(n), true
+}
+
+// Resolve positions (numbers, ranges, or lists thereof) on the specified strip
+func (l Layout) resolveStripPositions(strip uint, positions string) ([]uint8, error) {
+	leds, err := l.strip(strip)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []uint8
+	for _, item := range strings.Split(positions, ",") {
+		indices, err := parseIndices(strings.TrimSpace(item), uint64(l.StripLen))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, i := range indices {
+			ret = append(ret, leds[i])
+		}
+	}
+
+	return ret, nil
+}
+
+// Resolve a comma-separated list of LED numbers, ranges, strips ("s<n>")
+// and named groups.
+func (l Layout) resolveList(list string) ([]uint8, error) {
+	var ret []uint8
+
+	for _, item := range strings.Split(list, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+
+		if strip, ok := parseStrip(item); ok {
+			leds, err := l.strip(strip)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, leds...)
+			continue
+		}
+
+		if item == "left" || item == "right" {
+			leds, err := l.group(item)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, leds...)
+			continue
+		}
+
+		indices, err := parseIndices(item, ALL_LEDS)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, i := range indices {
+			if err := l.checkLed(i); err != nil {
+				return nil, err
+			}
+			ret = append(ret, uint8(i))
+		}
+	}
+
+	return ret, nil
+}
+
+// Remove duplicate LED numbers, retaining the first occurrence of each
+func dedup(leds []uint8) []uint8 {
+	seen := map[uint8]bool{}
+	ret := leds[:0]
+	for _, led := range leds {
+		if !seen[led] {
+			seen[led] = true
+			ret = append(ret, led)
+		}
+	}
+	return ret
+}
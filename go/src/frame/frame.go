@@ -12,9 +12,10 @@ import (
 const ALL_LEDS = 0x3f
 
 type Frame struct {
-	Led   uint8       // LED # or skullsup.ALL_LEDS
-	Color color.Color // RGB color value
-	Delay bool        // Include an intra-frame delay after updating LED(s)
+	Led      uint8       // LED # or skullsup.ALL_LEDS
+	Color    color.Color // RGB color value
+	Delay    bool        // Include an intra-frame delay after updating LED(s)
+	Duration uint8       // Delay multiplier. 0 is equivalent to 1.
 }
 
 func validDuration(x uint64) bool {
@@ -22,6 +23,9 @@ func validDuration(x uint64) bool {
 }
 
 // color[:led[:options]]
+//
+// Options may be "N" to skip the frame delay, or "x<n>" to hold the frame
+// for n frame periods.
 func New(s string) (Frame, error) {
 	var frame Frame
 	var err error
@@ -51,16 +55,122 @@ func New(s string) (Frame, error) {
 
 	frame.Delay = true
 	if len(fields) >= 3 {
-		if fields[2] == "n" || fields[2] == "N" {
-			frame.Delay = false
-		} else {
-			return Frame{}, fmt.Errorf("Invalid option flag: %s", fields[3])
+		if err = frame.parseOptions(fields[2]); err != nil {
+			return Frame{}, err
 		}
 	}
 
 	return frame, nil
 }
 
+func isOptions(s string) bool {
+	return s == "n" || s == "N" || (len(s) > 1 && (s[0] == 'x' || s[0] == 'X'))
+}
+
+// Apply frame options:
+//	N       - Do not include a delay
+//	x<n>    - Hold for n frame periods
+func (f *Frame) parseOptions(s string) error {
+	if s == "n" || s == "N" {
+		f.Delay = false
+		return nil
+	} else if !isOptions(s) {
+		return fmt.Errorf("Invalid option flag: %s", s)
+	}
+
+	n, err := strconv.ParseUint(s[1:], 10, 8)
+	if err != nil || n == 0 {
+		return fmt.Errorf("Invalid frame duration: %s", s[1:])
+	}
+
+	f.Delay = true
+	f.Duration = uint8(n)
+	return nil
+}
+
+// Parse a frame string, expanding addresses that refer to multiple LEDs into
+// one frame per LED. Only the last of these frames includes the frame delay,
+// such that all of the addressed LEDs appear to change at the same time.
+//
+// The following forms are supported:
+//
+//	color[:address[:options]]
+//	color:s<strip>:<positions>[:options]
+//
+// An address may be "all", or a comma-separated list of LED numbers, inclusive
+// ranges (e.g., "0-7"), strips (e.g., "s1"), and named groups ("left" and
+// "right"). Strip positions accept numbers, ranges, and lists.
+//
+// Strips and groups require the device's LED layout. If the layout is
+// not known, a zero-valued Layout may be provided.
+func Parse(s string, layout Layout) ([]Frame, error) {
+	var leds []uint8
+	var err error
+
+	fields := strings.Split(s, ":")
+
+	c, err := color.New(fields[0])
+	if err != nil {
+		return nil, err
+	}
+
+	rest := fields[1:]
+	if len(rest) == 0 || strings.ToLower(rest[0]) == "all" {
+		leds = []uint8{ALL_LEDS}
+		if len(rest) > 0 {
+			rest = rest[1:]
+		}
+	} else if strip, ok := parseStrip(rest[0]); ok && len(rest) >= 2 && !isOptions(rest[1]) {
+		if leds, err = layout.resolveStripPositions(strip, rest[1]); err != nil {
+			return nil, err
+		}
+		rest = rest[2:]
+	} else {
+		if leds, err = layout.resolveList(rest[0]); err != nil {
+			return nil, err
+		}
+		rest = rest[1:]
+	}
+
+	if len(rest) > 1 {
+		return nil, fmt.Errorf("Invalid frame: %s", s)
+	}
+
+	options := Frame{Delay: true}
+	if len(rest) == 1 {
+		if err = options.parseOptions(rest[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	leds = dedup(leds)
+	frames := make([]Frame, len(leds))
+	for i, led := range leds {
+		frames[i] = Frame{Led: led, Color: c, Delay: false}
+	}
+	frames[len(frames)-1].Delay = options.Delay
+	frames[len(frames)-1].Duration = options.Duration
+
+	return frames, nil
+}
+
+// Expand frames with a duration multiplier into repeated delayed frames.
+// The repeated frame is always the last update prior to the delay,
+// so repeating it does not otherwise alter the displayed output.
+func Expand(frames []Frame) []Frame {
+	var ret []Frame
+	for _, f := range frames {
+		n := f.Duration
+		f.Duration = 0
+		ret = append(ret, f)
+
+		for i := uint8(1); f.Delay && i < n; i++ {
+			ret = append(ret, f)
+		}
+	}
+	return ret
+}
+
 func MustCreate(s string) Frame {
 	if frame, err := New(s); err != nil {
 		panic(err)
@@ -70,7 +180,7 @@ func MustCreate(s string) Frame {
 }
 
 func NewColor(c color.Color) Frame {
-	return Frame{ALL_LEDS, c, true}
+	return Frame{Led: ALL_LEDS, Color: c, Delay: true}
 }
 
 func (f *Frame) String() string {
@@ -78,6 +188,8 @@ func (f *Frame) String() string {
 	options := ""
 	if !f.Delay {
 		options = ":N"
+	} else if f.Duration > 1 {
+		options = fmt.Sprintf(":x%d", f.Duration)
 	}
 	return fmt.Sprintf("%s:%d%s\n", c, f.Led, options)
 }
@@ -0,0 +1,144 @@
+// SPDX License Identifier: MIT
+package frame
+
+import "github.com/jynik/skullsup/go/src/color"
+
+// State of a single LED. An LED's state is unknown until a frame sets it,
+// as it retains whatever was displayed prior to the animation.
+type ledState struct {
+	known bool
+	color color.Color
+}
+
+type state []ledState
+
+func (s state) apply(f Frame) {
+	if f.Led == ALL_LEDS {
+		for i := range s {
+			s[i] = ledState{true, f.Color}
+		}
+	} else if int(f.Led) < len(s) {
+		// Like the firmware, ignore updates to non-existent LEDs
+		s[f.Led] = ledState{true, f.Color}
+	}
+}
+
+func (s state) allKnown() bool {
+	for _, led := range s {
+		if !led.known {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns an update that does not change the state. The provided frame is
+// returned if no LEDs are known, as it must address a non-existent LED.
+func (s state) noop(f Frame) Frame {
+	for i, led := range s {
+		if led.known {
+			return Frame{Led: uint8(i), Color: led.color}
+		}
+	}
+	f.Delay = false
+	return f
+}
+
+// Returns the most common color in a fully known state
+func (s state) dominantColor() color.Color {
+	var ret color.Color
+	counts := map[color.Color]int{}
+	max := 0
+
+	for _, led := range s {
+		counts[led.color]++
+		if n := counts[led.color]; n > max {
+			max = n
+			ret = led.color
+		}
+	}
+	return ret
+}
+
+// Updates needed to transition from prev to next, addressing LEDs individually
+func individualUpdates(prev, next state) []Frame {
+	var ret []Frame
+	for i := range next {
+		if next[i].known && next[i] != prev[i] {
+			ret = append(ret, Frame{Led: uint8(i), Color: next[i].color})
+		}
+	}
+	return ret
+}
+
+// Updates needed to transition to next, starting with an ALL_LEDS fill
+func fillUpdates(next state) []Frame {
+	c := next.dominantColor()
+	ret := []Frame{{Led: ALL_LEDS, Color: c}}
+	for i := range next {
+		if next[i].color != c {
+			ret = append(ret, Frame{Led: uint8(i), Color: next[i].color})
+		}
+	}
+	return ret
+}
+
+// Emit the minimal set of updates to transition from prev to next. The
+// provided frame is used if no updates are required, but a delay is.
+func encodeSegment(prev, next state, delay bool, noop Frame) []Frame {
+	ret := individualUpdates(prev, next)
+
+	// A fill would clobber LEDs whose prior state should be retained
+	if next.allKnown() {
+		if fill := fillUpdates(next); len(fill) < len(ret) {
+			ret = fill
+		}
+	}
+
+	// Nothing changed, but the delay must be retained
+	if len(ret) == 0 {
+		if !delay {
+			return ret
+		}
+		ret = []Frame{noop}
+	}
+
+	ret[len(ret)-1].Delay = delay
+	return ret
+}
+
+// Optimize a list of frames for a device with the specified number of LEDs.
+//
+// The state of each LED is computed at every delayed frame (i.e., each time
+// the LEDs are displayed), and the minimal set of updates required to
+// reproduce those states is emitted. An ALL_LEDS fill is used when it is
+// cheaper than updating LEDs individually. The displayed output is preserved,
+// including the first pass through the animation.
+//
+// The frames are returned unmodified if the LED count is invalid.
+func Optimize(frames []Frame, ledCount uint) []Frame {
+	if ledCount == 0 || ledCount >= ALL_LEDS {
+		return frames
+	}
+
+	var ret []Frame
+	prev := make(state, ledCount)
+	next := make(state, ledCount)
+
+	for i, f := range frames {
+		next.apply(f)
+
+		// Trailing no-delay frames are displayed at the start of the next
+		// pass through the animation, so they must also be encoded.
+		if f.Delay || i == len(frames)-1 {
+			segment := encodeSegment(prev, next, f.Delay, next.noop(f))
+			if len(segment) != 0 {
+				segment[len(segment)-1].Duration = f.Duration
+			}
+			ret = append(ret, segment...)
+			copy(prev, next)
+		}
+	}
+
+	return ret
+}
@@ -0,0 +1,171 @@
+// SPDX License Identifier: MIT
+package frame
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/jynik/skullsup/go/src/color"
+)
+
+// Simulate the LEDs displayed at each frame period while the animation is
+// looped the specified number of times. Each LED initially displays a
+// distinct color, as it retains whatever was shown before the animation.
+func display(frames []Frame, ledCount uint, passes int) [][]color.Color {
+	var ret [][]color.Color
+
+	leds := make([]color.Color, ledCount)
+	for i := range leds {
+		leds[i] = color.Color{Red: uint8(i), Green: 0xa5, Blue: 0x5a}
+	}
+
+	for pass := 0; pass < passes; pass++ {
+		for _, f := range frames {
+			if f.Led == ALL_LEDS {
+				for i := range leds {
+					leds[i] = f.Color
+				}
+			} else if uint(f.Led) < ledCount {
+				leds[f.Led] = f.Color
+			}
+
+			if !f.Delay {
+				continue
+			}
+
+			n := int(f.Duration)
+			if n < 1 {
+				n = 1
+			}
+			for i := 0; i < n; i++ {
+				ret = append(ret, append([]color.Color{}, leds...))
+			}
+		}
+	}
+
+	return ret
+}
+
+func mustParse(t *testing.T, strs ...string) []Frame {
+	var ret []Frame
+	for _, s := range strs {
+		frames, err := Parse(s, Layout{})
+		if err != nil {
+			t.Fatalf("%s: %s", s, err)
+		}
+		ret = append(ret, frames...)
+	}
+	return ret
+}
+
+func checkEquivalent(t *testing.T, name string, frames []Frame, ledCount uint) []Frame {
+	optimized := Optimize(frames, ledCount)
+
+	want := display(frames, ledCount, 3)
+	if got := display(optimized, ledCount, 3); !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: optimized output differs from the original", name)
+	}
+
+	if got := display(Expand(optimized), ledCount, 3); !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: expanded output differs from the original", name)
+	}
+
+	if len(optimized) > len(Expand(frames)) {
+		t.Errorf("%s: optimized to %d frames, from %d", name, len(optimized), len(frames))
+	}
+
+	return optimized
+}
+
+func TestOptimizePreservesOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames []string
+		leds   uint
+		max    int // Maximum number of optimized frames, or 0 to skip this check
+	}{
+		{"fill", []string{"ff0000:all", "00ff00:all"}, 4, 2},
+		{"individual fills collapse", []string{"ff0000:0:N", "ff0000:1:N", "ff0000:2:N", "ff0000:3"}, 4, 1},
+		{"fill with exception", []string{"0000ff:0:N", "0000ff:1:N", "ff0000:2:N", "0000ff:3"}, 4, 2},
+		{"redundant updates", []string{"ff0000:all:N", "ff0000:all:N", "00ff00:1"}, 4, 2},
+		{"partial updates", []string{"ff0000:0", "00ff00:1", "0000ff:2"}, 4, 3},
+		{"unchanged delay", []string{"ff0000:all", "ff0000:all", "ff0000:all"}, 4, 3},
+		{"duration hold", []string{"ff0000:all:x3", "00ff00:0:x2", "000000:all"}, 4, 3},
+		{"duration on unchanged frame", []string{"ff0000:all", "ff0000:all:x4"}, 4, 2},
+		{"trailing no-delay", []string{"ff0000:all", "00ff00:0:N"}, 4, 0},
+		{"leading no-delay", []string{"00ff00:1:N", "ff0000:0", "0000ff:all"}, 4, 0},
+		{"non-existent LED", []string{"ff0000:all", "00ff00:9", "0000ff:0"}, 4, 0},
+		{"no delays", []string{"ff0000:0:N", "00ff00:1:N"}, 4, 0},
+	}
+
+	for _, test := range tests {
+		frames := mustParse(t, test.frames...)
+		optimized := checkEquivalent(t, test.name, frames, test.leds)
+
+		if test.max > 0 && len(optimized) > test.max {
+			t.Errorf("%s: expected at most %d frames, got %d", test.name, test.max, len(optimized))
+		}
+	}
+}
+
+func TestOptimizeCollapsesToFill(t *testing.T) {
+	var frames []Frame
+	for i := 0; i < 16; i++ {
+		frames = append(frames, Frame{Led: uint8(i), Color: color.Color{Red: 0xff}})
+	}
+	frames[len(frames)-1].Delay = true
+
+	optimized := checkEquivalent(t, "collapse", frames, 16)
+	if len(optimized) != 1 || optimized[0].Led != ALL_LEDS {
+		t.Errorf("Expected a single ALL_LEDS frame, got %v", optimized)
+	}
+}
+
+func TestOptimizeRetainsDuration(t *testing.T) {
+	frames := mustParse(t, "ff0000:all:x5", "00ff00:all:x7")
+
+	optimized := checkEquivalent(t, "durations", frames, 8)
+	if Periods(optimized) != 12 {
+		t.Errorf("Expected 12 frame periods, got %d", Periods(optimized))
+	}
+	if n := len(Expand(optimized)); n != 12 {
+		t.Errorf("Expected 12 expanded frames, got %d", n)
+	}
+}
+
+func TestOptimizeRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	palette := []color.Color{{}, {Red: 0xff}, {Green: 0xff}, {Blue: 0xff}}
+
+	for n := 0; n < 500; n++ {
+		ledCount := uint(1 + rng.Intn(16))
+		frames := make([]Frame, 1+rng.Intn(24))
+
+		for i := range frames {
+			led := uint8(rng.Intn(int(ledCount) + 1))
+			if rng.Intn(4) == 0 {
+				led = ALL_LEDS
+			}
+
+			frames[i] = Frame{
+				Led:      led,
+				Color:    palette[rng.Intn(len(palette))],
+				Delay:    rng.Intn(3) != 0,
+				Duration: uint8(rng.Intn(4)),
+			}
+		}
+
+		checkEquivalent(t, "random", frames, ledCount)
+	}
+}
+
+func TestOptimizeInvalidLedCount(t *testing.T) {
+	frames := mustParse(t, "ff0000:all", "00ff00:0")
+
+	for _, ledCount := range []uint{0, ALL_LEDS} {
+		if got := Optimize(frames, ledCount); !reflect.DeepEqual(got, frames) {
+			t.Errorf("Expected frames to be unmodified for %d LEDs", ledCount)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+// SPDX License Identifier: MIT
+package frame
+
+import "fmt"
+
+// Split frames into segments of at most max frames, such that each can be
+// uploaded and played in turn. Segments only end after delayed frames.
+//
+// Frames should be expanded prior to splitting, as segments are sized
+// without regard to duration multipliers.
+func Split(frames []Frame, max uint) ([][]Frame, error) {
+	var ret [][]Frame
+	start := 0
+
+	for start < len(frames) {
+		end := start
+		for i := start; i < len(frames) && uint(i-start) < max; i++ {
+			if frames[i].Delay || i == len(frames)-1 {
+				end = i + 1
+			}
+		}
+
+		if end == start {
+			return nil, fmt.Errorf("Frames %d-%d cannot be split into segments of %d frames", start, start+int(max)-1, max)
+		}
+
+		ret = append(ret, frames[start:end])
+		start = end
+	}
+
+	return ret, nil
+}
+
+// Returns the number of frame periods required to play the frames once
+func Periods(frames []Frame) uint {
+	var n uint
+	for _, f := range frames {
+		if f.Delay {
+			if f.Duration > 1 {
+				n += uint(f.Duration)
+			} else {
+				n++
+			}
+		}
+	}
+	return n
+}
@@ -96,28 +96,55 @@ func (c *Client) CanWrite(queue string) bool {
 	return c.canAccess(queue, c.Cfg.WriteQueues)
 }
 
+// Convert an unsuccessful response to an error. Servers describe errors with
+// a JSON network.Error, but older ones respond with only plain text.
 func responseAsError(r *http.Response) error {
-	var statusText string
-	if r.ContentLength >= 1 {
-		buf := make([]byte, r.ContentLength)
-		r.Body.Read(buf)
-
-		// Trim newline
-		if buf[len(buf)-1] == '\n' {
-			buf = buf[:len(buf)-1]
-		}
+	if r.StatusCode == http.StatusNoContent {
+		return network.ErrQueueEmpty
+	}
 
-		statusText = string(buf)
+	// The body may be chunked, in which case its length is not known
+	buf, _ := ioutil.ReadAll(r.Body)
+	buf = bytes.TrimSpace(buf)
+
+	var e network.Error
+	if json.Unmarshal(buf, &e) == nil && e.Code != "" {
+		switch e.Code {
+		case network.CodeQueueEmpty:
+			return network.ErrQueueEmpty
+		case network.CodeQueueFull:
+			return network.ErrQueueFull
+		}
+		return &e
+	}
 
-	} else {
+	statusText := string(buf)
+	switch statusText {
+	case network.ErrorQueueEmpty:
+		return network.ErrQueueEmpty
+	case network.ErrorQueueFull:
+		return network.ErrQueueFull
+	case "":
 		statusText = http.StatusText(r.StatusCode)
 	}
 
 	return fmt.Errorf("Received status %d: %s", r.StatusCode, statusText)
 }
 
-// Read a messsage from the specified queue
+// Returns the configured long-polling wait, or 0 if long-polling is disabled
+func (c *Client) LongPoll() time.Duration {
+	return time.Duration(c.Cfg.LongPoll) * time.Second
+}
+
+// Read a messsage from the specified queue, waiting for one to arrive if the
+// queue is empty and long-polling is enabled
 func (c *Client) Read(queue string) (*network.Message, error) {
+	return c.ReadWait(queue, c.LongPoll())
+}
+
+// Read a message from the specified queue, asking the server to wait up to
+// the specified amount of time for one to arrive if the queue is empty.
+func (c *Client) ReadWait(queue string, wait time.Duration) (*network.Message, error) {
 	var msg network.Message
 
 	if !c.CanRead(queue) {
@@ -125,6 +152,10 @@ func (c *Client) Read(queue string) (*network.Message, error) {
 	}
 
 	url := network.QueueUrl(c.Cfg.Host, c.Cfg.Port, queue)
+	if wait > 0 {
+		url = network.QueueWaitUrl(c.Cfg.Host, c.Cfg.Port, queue, wait)
+	}
+
 	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
@@ -133,16 +164,18 @@ func (c *Client) Read(queue string) (*network.Message, error) {
 	resp, err := c.Do(req)
 	if err != nil {
 		return nil, err
-	} else if resp.StatusCode != 200 {
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
 		return nil, responseAsError(resp)
-	} else if resp.ContentLength < 1 {
-		return nil, errors.New("Received empty response")
 	}
 
-	defer resp.Body.Close()
 	buf, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
+	} else if len(buf) == 0 {
+		return nil, errors.New("Received empty response")
 	}
 
 	err = json.Unmarshal(buf, &msg)
@@ -153,6 +186,43 @@ func (c *Client) Read(queue string) (*network.Message, error) {
 	return &msg, nil
 }
 
+func (c *Client) sendAction(queue string, msg *network.Message, action string) error {
+	// The server deleted the message when it was read
+	if msg.Visibility == 0 {
+		return nil
+	}
+
+	url := network.MessageActionUrl(c.Cfg.Host, c.Cfg.Port, queue, msg.ID, action)
+	req, err := http.NewRequest(http.MethodPost, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return responseAsError(resp)
+	}
+
+	return nil
+}
+
+// Acknowledge that a message read from the specified queue has been handled,
+// such that the server deletes it
+func (c *Client) Ack(queue string, msg *network.Message) error {
+	return c.sendAction(queue, msg, network.ActionAck)
+}
+
+// Report that a message read from the specified queue could not be handled,
+// such that the server redelivers it
+func (c *Client) Nack(queue string, msg *network.Message) error {
+	return c.sendAction(queue, msg, network.ActionNack)
+}
+
 // Write a message to the specified queue
 func (c *Client) Write(msg *network.Message, queue string) error {
 	msg.Command = strings.ToLower(msg.Command)
@@ -160,6 +230,7 @@ func (c *Client) Write(msg *network.Message, queue string) error {
 	case network.CmdColor:
 	case network.CmdIncant:
 	case network.CmdReanimate:
+	case network.CmdScript:
 	default:
 		return fmt.Errorf("Invalid command: %s", msg.Command)
 	}
@@ -178,23 +249,11 @@ func (c *Client) Write(msg *network.Message, queue string) error {
 	resp, err := c.Do(req)
 	if err != nil {
 		return err
-	} else if resp.StatusCode != 200 {
-		if resp.ContentLength >= 1 {
-			defer resp.Body.Close()
-			buf, err := ioutil.ReadAll(resp.Body)
-			if err != nil {
-				return err
-			}
-
-			if len(buf) > 1 {
-				// Trim newline
-				buf = buf[:len(buf)-1]
-				return fmt.Errorf("Status %d: %s", resp.StatusCode, buf)
-			}
-		}
+	}
+	defer resp.Body.Close()
 
-		// At least return the status code if we're lost here...
-		return fmt.Errorf("¯\\_(ツ)_/¯  Status %d", resp.StatusCode)
+	if resp.StatusCode != 200 {
+		return responseAsError(resp)
 	}
 
 	return nil
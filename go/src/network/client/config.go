@@ -38,6 +38,15 @@ type Config struct {
 	// Server polling period in seconds.
 	PollPeriod int `json:"poll_period"`
 
+	// Time, in seconds, that the server may hold a read request open while
+	// waiting for a message to arrive. Defaults to 30. A negative value
+	// disables long-polling, in which case readers poll every PollPeriod.
+	LongPoll int `json:"long_poll"`
+
+	// Subscribe to a stream of messages from each queue, rather than
+	// long-polling them
+	Subscribe bool `json:"subscribe"`
+
 	// Default frame period, in ms
 	FramePeriod int `json:"frame_period"`
 
@@ -104,6 +113,12 @@ func loadConfig(filename string) (*Config, error) {
 		config.PollPeriod = 15
 	}
 
+	if config.LongPoll == 0 {
+		config.LongPoll = 30
+	} else if config.LongPoll < 0 {
+		config.LongPoll = 0
+	}
+
 	if config.FramePeriod < 0 {
 		// Use the incantation's default
 		config.FramePeriod = 0
@@ -0,0 +1,72 @@
+// SPDX License Identifier: MIT
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/jynik/skullsup/go/src/network"
+)
+
+func (c *Client) getJSON(url string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return responseAsError(resp)
+	}
+
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(buf, v)
+}
+
+// List the queues available to the client, and summarize their contents
+func (c *Client) List() ([]network.QueueStatus, error) {
+	var queues []network.QueueStatus
+	err := c.getJSON(network.QueueListUrl(c.Cfg.Host, c.Cfg.Port), &queues)
+	return queues, err
+}
+
+// Summarize the contents of the specified queue
+func (c *Client) Status(queue string) (*network.QueueStatus, error) {
+	var status network.QueueStatus
+
+	if !c.CanRead(queue) && !c.CanWrite(queue) {
+		return nil, fmt.Errorf("Client is not configured to access \"%s\"", queue)
+	}
+
+	url := network.QueueViewUrl(c.Cfg.Host, c.Cfg.Port, queue, network.ViewStatus)
+	if err := c.getJSON(url, &status); err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+// Returns the messages awaiting delivery in the specified queue, in the order
+// they will be delivered, without removing them
+func (c *Client) Peek(queue string) ([]network.Message, error) {
+	var msgs []network.Message
+
+	if !c.CanRead(queue) && !c.CanWrite(queue) {
+		return nil, fmt.Errorf("Client is not configured to access \"%s\"", queue)
+	}
+
+	url := network.QueueViewUrl(c.Cfg.Host, c.Cfg.Port, queue, network.ViewPeek)
+	err := c.getJSON(url, &msgs)
+	return msgs, err
+}
@@ -0,0 +1,143 @@
+// SPDX License Identifier: MIT
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jynik/skullsup/go/src/network"
+)
+
+// A subscription is considered broken if nothing, not even a heartbeat,
+// is received from the server for this long
+const StreamTimeout = 4 * network.Heartbeat
+
+// Stream of messages from a queue, delivered as they are enqueued
+type Subscription struct {
+	// ID of the last message received
+	LastID uint64
+
+	body   io.ReadCloser
+	reader *bufio.Reader
+	idle   *time.Timer
+}
+
+// Subscribe to a queue. If lastID is non-zero, messages dequeued after the
+// message with this ID are redelivered.
+func (c *Client) Subscribe(queue string, lastID uint64) (*Subscription, error) {
+	if !c.CanRead(queue) {
+		return nil, fmt.Errorf("Client is not configured to read from \"%s\"", queue)
+	}
+
+	url := network.QueueUrl(c.Cfg.Host, c.Cfg.Port, queue)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", network.EventStream)
+	if lastID != 0 {
+		req.Header.Set(network.LastEventID, strconv.FormatUint(lastID, 10))
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	} else if resp.StatusCode != 200 {
+		defer resp.Body.Close()
+		return nil, responseAsError(resp)
+	} else if !strings.HasPrefix(resp.Header.Get("Content-Type"), network.EventStream) {
+		resp.Body.Close()
+		return nil, errors.New("Server does not support subscriptions")
+	}
+
+	sub := &Subscription{
+		LastID: lastID,
+		body:   resp.Body,
+		reader: bufio.NewReader(resp.Body),
+	}
+
+	// Closing the body unblocks a pending Next()
+	sub.idle = time.AfterFunc(StreamTimeout, func() { resp.Body.Close() })
+
+	return sub, nil
+}
+
+// Wait for the next message
+func (s *Subscription) Next() (*network.Message, error) {
+	var event, data string
+	var id uint64
+
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			if !s.idle.Stop() {
+				return nil, errors.New("Subscription timed out")
+			}
+			return nil, err
+		}
+		s.idle.Reset(StreamTimeout)
+
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if data == "" {
+				continue
+			} else if event == network.EventError {
+				var e network.Error
+				if json.Unmarshal([]byte(data), &e) == nil && e.Code != "" {
+					return nil, &e
+				}
+				return nil, fmt.Errorf("Server error: %s", data)
+			} else if event != "" && event != network.EventMessage {
+				event, data = "", ""
+				continue
+			}
+
+			var msg network.Message
+			if err := json.Unmarshal([]byte(data), &msg); err != nil {
+				return nil, err
+			}
+
+			if id != 0 {
+				s.LastID = id
+			}
+			return &msg, nil
+		}
+
+		// Comments serve as heartbeats
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value := line, ""
+		if i := strings.Index(line, ":"); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			if data != "" {
+				data += "\n"
+			}
+			data += value
+		case "id":
+			if id, err = strconv.ParseUint(value, 10, 64); err != nil {
+				return nil, fmt.Errorf("Invalid event ID: %s", value)
+			}
+		}
+	}
+}
+
+func (s *Subscription) Close() error {
+	s.idle.Stop()
+	return s.body.Close()
+}
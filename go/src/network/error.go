@@ -0,0 +1,75 @@
+// SPDX License Identifier: MIT
+package network
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Machine-readable error codes
+const (
+	CodeBadRequest       = "bad_request"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeTooLarge         = "too_large"
+	CodeExpired          = "expired"
+	CodeQueueEmpty       = "queue_empty"
+	CodeQueueFull        = "queue_full"
+	CodeTooManyQueues    = "too_many_queues"
+	CodeInternal         = "internal"
+)
+
+// HTTP status corresponding to each error code
+var codeStatus = map[string]int{
+	CodeBadRequest:       http.StatusBadRequest,
+	CodeForbidden:        http.StatusForbidden,
+	CodeNotFound:         http.StatusNotFound,
+	CodeMethodNotAllowed: http.StatusMethodNotAllowed,
+	CodeTooLarge:         http.StatusRequestEntityTooLarge,
+	CodeExpired:          http.StatusBadRequest,
+	CodeQueueEmpty:       http.StatusNoContent,
+	CodeQueueFull:        http.StatusTooManyRequests,
+	CodeTooManyQueues:    http.StatusInsufficientStorage,
+	CodeInternal:         http.StatusInternalServerError,
+}
+
+// Error returned by the server, as the JSON body of an unsuccessful response.
+// Empty queues are instead indicated by a 204 (No Content) response.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// HTTP status code corresponding to the error
+func (e *Error) Status() int {
+	if status, ok := codeStatus[e.Code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// Create an error with the specified code and formatted message
+func Errorf(code string, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Returns the code of an *Error, or CodeInternal for any other error
+func ErrorCode(err error) string {
+	if e, ok := err.(*Error); ok {
+		return e.Code
+	}
+	return CodeInternal
+}
+
+var (
+	ErrQueueEmpty    = &Error{CodeQueueEmpty, ErrorQueueEmpty}
+	ErrQueueFull     = &Error{CodeQueueFull, ErrorQueueFull}
+	ErrTooManyQueues = &Error{CodeTooManyQueues, ErrorTooManyQueues}
+	ErrNoSuchMsg     = &Error{CodeNotFound, ErrorNoSuchMsg}
+	ErrExpired       = &Error{CodeExpired, ErrorExpired}
+)
@@ -1,21 +1,55 @@
 // SPDX License Identifier: MIT
 package network
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 // Command
 const (
 	CmdColor     = "color"
 	CmdReanimate = "reanimate"
 	CmdIncant    = "incant"
+	CmdScript    = "script" // Args: script source, followed by psalm arguments
 )
 
+// Highest message priority
+const MaxPriority = 9
+
 type Message struct {
+	// Assigned by the server when the message is queued. IDs increase
+	// monotonically, such that a subscriber can resume after the last
+	// message it received.
+	ID uint64 `json:"id,omitempty"`
+
+	// Time at which the server queued the message
+	Enqueued *time.Time `json:"enqueued,omitempty"`
+
+	// Seconds after being read that the message will be redelivered, unless
+	// it is acknowledged. If zero, the message need not be acknowledged.
+	Visibility int `json:"visibility_timeout,omitempty"`
+
+	// Seconds after being queued that the message expires, if ExpiresAt
+	// is not specified
+	TTL int `json:"ttl,omitempty"`
+
+	// Time after which the message is discarded, rather than delivered
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// Time before which the message will not be delivered
+	NotBefore *time.Time `json:"not_before,omitempty"`
+
+	// Messages with higher priorities are delivered first, in the range
+	// [0, MaxPriority]. Messages of the same priority are delivered in the
+	// order they were queued.
+	Priority int `json:"priority,omitempty"`
+
 	Command string   `json:"cmd"`
 	Args    []string `json:"args"`
 	Period  int      `json:"period"`
 }
 
 func (m *Message) String() string {
-	return fmt.Sprintf("{ %s %s (%d ms) }", m.Command, m.Args, m.Period)
+	return fmt.Sprintf("{ #%d %s %s (%d ms) }", m.ID, m.Command, m.Args, m.Period)
 }
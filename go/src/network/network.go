@@ -2,21 +2,128 @@
 package network
 
 import (
+	"errors"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const QueueEndpoint = "hell"
 
+// Queue reads requesting this content type subscribe to a stream of
+// Server-Sent Events, rather than reading a single message
+const EventStream = "text/event-stream"
+
+// Event types sent to subscribers
+const (
+	EventMessage = "message"
+	EventError   = "error"
+)
+
+// Header in which a subscriber provides the ID of the last message it received
+const LastEventID = "Last-Event-ID"
+
+// Period at which the server sends a comment to idle subscribers, such
+// that they can detect a broken connection
+const Heartbeat = 15 * time.Second
+
+// Query parameter specifying how long a read may wait for a message to arrive
+const WaitParam = "wait"
+
 const (
-	ErrorQueueFull  = "There's no room left for the Damned in Hell."
-	ErrorQueueEmpty = "We're fresh out of souls. Reap again later."
+	ErrorQueueFull     = "There's no room left for the Damned in Hell."
+	ErrorTooManyQueues = "Hell has no room for another circle."
+	ErrorQueueEmpty    = "We're fresh out of souls. Reap again later."
+	ErrorNoSuchMsg     = "No such soul awaits judgement."
+	ErrorExpired       = "This soul withered away before it could be reaped."
+)
+
+// Acknowledgement actions, which follow a message ID in a queue's URL
+const (
+	// The message was handled and may be deleted
+	ActionAck = "ack"
+
+	// The message could not be handled and should be redelivered
+	ActionNack = "nack"
 )
 
 func QueueUrl(host string, port uint16, queue string) string {
 	return "https://" + host + ":" + strconv.Itoa(int(port)) + "/" + QueueEndpoint + "/" + queue
 }
 
+// URL of a queue read that waits up to the specified time for a message
+func QueueWaitUrl(host string, port uint16, queue string, wait time.Duration) string {
+	return QueueUrl(host, port, queue) + "?" + WaitParam + "=" + wait.String()
+}
+
+// Parse the value of the wait parameter: either a duration (e.g., "30s")
+// or a number of seconds
+func ParseWait(s string) (time.Duration, error) {
+	if secs, err := strconv.Atoi(s); err == nil {
+		s = strconv.Itoa(secs) + "s"
+	}
+
+	wait, err := time.ParseDuration(s)
+	if err == nil && wait < 0 {
+		err = errors.New("Negative wait: " + s)
+	}
+	return wait, err
+}
+
+// URL at which the specified message of a queue is acknowledged or
+// negatively acknowledged, per ActionAck or ActionNack
+func MessageActionUrl(host string, port uint16, queue string, id uint64, action string) string {
+	return QueueUrl(host, port, queue) + "/" + strconv.FormatUint(id, 10) + "/" + action
+}
+
+// Split a path of the form <queue>/<id>/<action>, as returned by QueueFromURL
+// for acknowledgements. Returns ok=false if the path does not take this form.
+func SplitMessageAction(path string) (queue string, id uint64, action string, ok bool) {
+	parts := strings.Split(path, "/")
+	if len(parts) < 3 {
+		return "", 0, "", false
+	}
+
+	n := len(parts)
+	action = parts[n-1]
+	if action != ActionAck && action != ActionNack {
+		return "", 0, "", false
+	}
+
+	id, err := strconv.ParseUint(parts[n-2], 10, 64)
+	if err != nil {
+		return "", 0, "", false
+	}
+
+	return strings.Join(parts[:n-2], "/"), id, action, true
+}
+
+// URL listing the queues available to a user
+func QueueListUrl(host string, port uint16) string {
+	return "https://" + host + ":" + strconv.Itoa(int(port)) + "/" + QueueEndpoint + "/"
+}
+
+// URL of a read-only view of a queue, per ViewStatus or ViewPeek
+func QueueViewUrl(host string, port uint16, queue string, view string) string {
+	return QueueUrl(host, port, queue) + "/" + view
+}
+
+// Split a path of the form <queue>/<view>, as returned by QueueFromURL.
+// Returns ok=false if the path does not take this form.
+func SplitQueueView(path string) (queue string, view string, ok bool) {
+	i := strings.LastIndex(path, "/")
+	if i < 1 {
+		return "", "", false
+	}
+
+	view = path[i+1:]
+	if view != ViewStatus && view != ViewPeek {
+		return "", "", false
+	}
+
+	return path[:i], view, true
+}
+
 func QueueFromURL(url string) string {
 	pfx := "/" + QueueEndpoint + "/"
 	if !strings.HasPrefix(url, pfx) {
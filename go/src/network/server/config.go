@@ -41,6 +41,36 @@ type Config struct {
 	// strings This is intended to serve as a quick and dirty revocation list.
 	Blacklist []string `json:"blacklist"`
 
+	// Maximum number of non-empty queues. Defaults to 10.
+	MaxQueues int `json:"max_queues"`
+
+	// Limits applied to each queue, unless overridden in Queues.
+	// Defaults to a depth of 16, with the "reject" overflow policy.
+	QueueLimits QueueLimits `json:"queue_limits"`
+
+	// Per-queue limits. Unspecified values are taken from QueueLimits.
+	Queues map[string]QueueLimits `json:"queues"`
+
+	// Longest time, in seconds, that a read may wait for a message to
+	// arrive in an empty queue. Defaults to 60. A negative value disables
+	// long-polling, such that reads of empty queues fail immediately.
+	MaxWait int `json:"max_wait"`
+
+	// Broadcast topics, which deliver each message written to them to every
+	// user with read access. Each topic's limits apply to every subscriber's
+	// inbox. Unspecified values are taken from QueueLimits, except that the
+	// overflow policy defaults to "drop-oldest".
+	Topics map[string]QueueLimits `json:"topics"`
+
+	// Time, in seconds, within which readers must acknowledge a message
+	// before it is redelivered. Defaults to 30. A negative value disables
+	// acknowledgements, such that messages are deleted as soon as they
+	// are read.
+	VisibilityTimeout int `json:"visibility_timeout"`
+
+	// Persistence of queued messages
+	Storage StorageConfig `json:"storage"`
+
 	// User configuration
 	Users network.UserList `json:"users"`
 }
@@ -54,7 +84,7 @@ func validateSerial(serial *string) error {
 	}
 
 	if _, err := hex.DecodeString(*serial); err != nil {
-		return fmt.Errorf("Invalid hex string: \"%s\"", serial)
+		return fmt.Errorf("Invalid hex string: \"%s\"", *serial)
 	} else {
 		*serial = strings.ToLower(*serial)
 	}
@@ -83,6 +113,47 @@ func loadConfig(filename string) (*Config, error) {
 	cfg.KeyPath = os.ExpandEnv(cfg.KeyPath)
 	cfg.CAPath = os.ExpandEnv(cfg.CAPath)
 	cfg.LogPath = os.ExpandEnv(cfg.LogPath)
+	cfg.Storage.Path = os.ExpandEnv(cfg.Storage.Path)
+
+	if err := cfg.Storage.validate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.MaxQueues == 0 {
+		cfg.MaxQueues = DefaultMaxQueues
+	} else if cfg.MaxQueues < 0 {
+		return nil, fmt.Errorf("Invalid maximum number of queues: %d", cfg.MaxQueues)
+	}
+
+	if cfg.MaxWait == 0 {
+		cfg.MaxWait = DefaultMaxWait
+	} else if cfg.MaxWait < 0 {
+		cfg.MaxWait = 0
+	}
+
+	if cfg.VisibilityTimeout == 0 {
+		cfg.VisibilityTimeout = DefaultVisibility
+	} else if cfg.VisibilityTimeout < 0 {
+		cfg.VisibilityTimeout = 0
+	}
+
+	cfg.QueueLimits = cfg.QueueLimits.inherit(QueueLimits{MaxDepth: DefaultMaxDepth, Overflow: OverflowReject})
+	if err := cfg.QueueLimits.validate(); err != nil {
+		return nil, err
+	}
+
+	for name, limits := range cfg.Topics {
+		if name == "" || strings.Contains(name, inboxSeparator) {
+			return nil, fmt.Errorf("Invalid topic name: \"%s\"", name)
+		} else if _, exists := cfg.Queues[name]; exists {
+			return nil, fmt.Errorf("\"%s\" is configured as both a queue and a topic", name)
+		}
+
+		if limits.Overflow == "" {
+			limits.Overflow = OverflowDropOldest
+			cfg.Topics[name] = limits
+		}
+	}
 
 	for i := range cfg.Blacklist {
 		if err := validateSerial(&cfg.Blacklist[i]); err != nil {
@@ -104,6 +175,16 @@ func loadConfig(filename string) (*Config, error) {
 			return nil, err
 		}
 
+		for _, queue := range append(cfg.Users[i].ReadQueues, cfg.Users[i].WriteQueues...) {
+			if isInbox(queue, cfg.Topics) {
+				return nil, fmt.Errorf("Queue \"%s\" of user \"%s\" conflicts with a topic's inbox", queue, name)
+			}
+		}
+
+		if p := cfg.Users[i].MaxPriority; p < 0 || p > network.MaxPriority {
+			return nil, fmt.Errorf("Invalid max_priority for user \"%s\": %d", name, p)
+		}
+
 		serial := cfg.Users[i].CertSerial
 
 		if _, exists := serialMap[serial]; exists {
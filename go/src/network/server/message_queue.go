@@ -2,62 +2,548 @@
 package server
 
 import (
-	"errors"
+	"context"
+	"fmt"
 	"sync"
+	"time"
 
 	"github.com/jynik/skullsup/go/src/network"
 )
 
+// Policies applied when a message is written to a full queue
+const (
+	// Reject the new message
+	OverflowReject = "reject"
+
+	// Discard the oldest message to make room for the new one
+	OverflowDropOldest = "drop-oldest"
+
+	// Discard pending color commands, as the new message would supersede
+	// them anyway. The new message is rejected if there are none.
+	OverflowCoalesce = "coalesce"
+)
+
+// Defaults used when limits are not configured
+const (
+	DefaultMaxQueues  = 10
+	DefaultMaxDepth   = 16
+	DefaultMaxWait    = 60 // Seconds
+	DefaultVisibility = 30 // Seconds
+)
+
+// Number of times a message is delivered without being acknowledged before
+// it is discarded
+const MaxDeliveries = 5
+
+type QueueLimits struct {
+	// Maximum number of pending messages
+	MaxDepth int `json:"max_depth"`
+
+	// Overflow policy: "reject", "drop-oldest", or "coalesce"
+	Overflow string `json:"overflow"`
+}
+
+func (l *QueueLimits) validate() error {
+	switch l.Overflow {
+	case OverflowReject, OverflowDropOldest, OverflowCoalesce:
+	default:
+		return fmt.Errorf("Invalid overflow policy: %s", l.Overflow)
+	}
+
+	if l.MaxDepth < 1 {
+		return fmt.Errorf("Invalid maximum queue depth: %d", l.MaxDepth)
+	}
+
+	return nil
+}
+
+// Returns the limits, with any unspecified values taken from defaults
+func (l QueueLimits) inherit(defaults QueueLimits) QueueLimits {
+	if l.MaxDepth == 0 {
+		l.MaxDepth = defaults.MaxDepth
+	}
+	if l.Overflow == "" {
+		l.Overflow = defaults.Overflow
+	}
+	return l
+}
+
 type queue []network.Message
 
 type MessageQueue struct {
 	mutex  sync.Mutex
 	queues map[string]queue
+	store  Store
 
 	maxQueues int
-	maxDepth  int
+	limits    QueueLimits            // Default limits
+	overrides map[string]QueueLimits // Per-queue limits
+
+	// Closed when a message is next written to the corresponding queue
+	arrivals map[string]chan struct{}
+
+	// Recently dequeued messages, which may be redelivered to subscribers
+	// that lost their connection before receiving them
+	delivered map[string]queue
+
+	nextID uint64
+
+	// Broadcast topics, and their subscribers' inboxes
+	topics  map[string]*topic
+	inboxes map[string]bool
+
+	// Messages that have been read, but not yet acknowledged, are hidden
+	// from readers until their deadline passes.
+	visibility time.Duration
+	inflight   map[uint64]time.Time
+	deliveries map[uint64]int
 }
 
+// Create a MessageQueue whose messages are only held in memory
 func NewMessageQueue(maxQueues, maxDepth int) *MessageQueue {
+	limits := QueueLimits{MaxDepth: maxDepth, Overflow: OverflowReject}
+	q, _ := OpenMessageQueue(maxQueues, limits, memoryStore{})
+	return q
+}
+
+// Create a MessageQueue whose messages are persisted by the provided Store,
+// restoring any messages it contains. The limits apply to all queues that
+// are not configured via SetLimits().
+func OpenMessageQueue(maxQueues int, limits QueueLimits, store Store) (*MessageQueue, error) {
 	var q MessageQueue
-	q.queues = make(map[string]queue)
+
+	if err := limits.validate(); err != nil {
+		return nil, err
+	}
+
+	loaded, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	q.store = store
 	q.maxQueues = maxQueues
-	q.maxDepth = maxDepth
-	return &q
+	q.limits = limits
+	q.queues = make(map[string]queue)
+	q.overrides = make(map[string]QueueLimits)
+	q.arrivals = make(map[string]chan struct{})
+	q.delivered = make(map[string]queue)
+	q.topics = make(map[string]*topic)
+	q.inboxes = make(map[string]bool)
+	q.inflight = make(map[uint64]time.Time)
+	q.deliveries = make(map[uint64]int)
+
+	// IDs are seeded from the current time, such that they continue to
+	// increase across restarts of a server whose queues are not persisted.
+	q.nextID = uint64(time.Now().UnixNano() / int64(time.Millisecond))
+
+	// Scheduled messages may wake readers as soon as they are restored, so
+	// the queue must be fully initialized before they are.
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for key, msgs := range loaded {
+		q.queues[key] = msgs
+		for _, m := range msgs {
+			if m.ID >= q.nextID {
+				q.nextID = m.ID + 1
+			}
+			if m.NotBefore != nil {
+				q.wakeAt(key, *m.NotBefore)
+			}
+		}
+	}
+
+	return &q, nil
 }
 
-func (mq *MessageQueue) Enqueue(key string, m network.Message) error {
+// Configure the limits of a specific queue. Unspecified values are taken
+// from the MessageQueue's defaults.
+func (mq *MessageQueue) SetLimits(key string, limits QueueLimits) error {
 	mq.mutex.Lock()
 	defer mq.mutex.Unlock()
 
-	q, exists := mq.queues[key]
-	if (!exists && len(mq.queues) >= mq.maxQueues) || len(q) > mq.maxDepth {
-		return errors.New(network.ErrorQueueFull)
+	limits = limits.inherit(mq.limits)
+	if err := limits.validate(); err != nil {
+		return fmt.Errorf("Queue \"%s\": %s", key, err)
 	}
 
-	if exists {
-		mq.queues[key] = append(q, m)
-	} else {
-		mq.queues[key] = []network.Message{m}
+	mq.overrides[key] = limits
+	return nil
+}
+
+// Require messages to be acknowledged within the specified time of being
+// read, after which they are redelivered. A timeout of 0 disables
+// acknowledgements, such that messages are deleted as soon as they are read.
+func (mq *MessageQueue) SetVisibilityTimeout(timeout time.Duration) {
+	mq.mutex.Lock()
+	defer mq.mutex.Unlock()
+	mq.visibility = timeout
+}
+
+func (mq *MessageQueue) limitsOf(key string) QueueLimits {
+	if limits, ok := mq.overrides[key]; ok {
+		return limits
+	}
+	return mq.limits
+}
+
+// Release the underlying storage
+func (mq *MessageQueue) Close() error {
+	mq.mutex.Lock()
+	defer mq.mutex.Unlock()
+	return mq.store.Close()
+}
+
+// Remove the message at the specified index of a queue
+func (mq *MessageQueue) remove(key string, i int) error {
+	if err := mq.store.Remove(key, i); err != nil {
+		return err
+	}
+
+	q := mq.queues[key]
+	delete(mq.inflight, q[i].ID)
+	delete(mq.deliveries, q[i].ID)
+	mq.forget(key, q[i].ID)
+
+	mq.queues[key] = append(q[:i:i], q[i+1:]...)
+	if len(mq.queues[key]) == 0 {
+		delete(mq.queues, key)
 	}
 
 	return nil
 }
 
+// Returns true if the message has expired
+func expired(m network.Message, now time.Time) bool {
+	return m.ExpiresAt != nil && !now.Before(*m.ExpiresAt)
+}
+
+// Returns true if the message is scheduled for later delivery
+func scheduled(m network.Message, now time.Time) bool {
+	return m.NotBefore != nil && now.Before(*m.NotBefore)
+}
+
+// Discard expired messages that are not awaiting acknowledgement
+func (mq *MessageQueue) purge(key string, now time.Time) error {
+	for i := len(mq.queues[key]) - 1; i >= 0; i-- {
+		m := mq.queues[key][i]
+		if _, inflight := mq.inflight[m.ID]; expired(m, now) && !inflight {
+			if err := mq.remove(key, i); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Make room in a full queue for a message of the specified priority,
+// according to the queue's overflow policy. Messages of a higher priority
+// are never discarded, nor are those awaiting acknowledgement, as their
+// readers may still be handling them. Returns the number of messages
+// discarded.
+func (mq *MessageQueue) overflow(key string, policy string, priority int) (int, error) {
+	dropped := 0
+
+	switch policy {
+	case OverflowDropOldest:
+		// Oldest of the lowest priority messages
+		oldest := -1
+		for i, m := range mq.queues[key] {
+			if _, inflight := mq.inflight[m.ID]; inflight {
+				continue
+			} else if oldest < 0 || m.Priority < mq.queues[key][oldest].Priority {
+				oldest = i
+			}
+		}
+
+		if oldest >= 0 && mq.queues[key][oldest].Priority <= priority {
+			if err := mq.remove(key, oldest); err != nil {
+				return 0, err
+			}
+			dropped++
+		}
+
+	case OverflowCoalesce:
+		for i := len(mq.queues[key]) - 1; i >= 0; i-- {
+			m := mq.queues[key][i]
+			if _, inflight := mq.inflight[m.ID]; inflight {
+				continue
+			} else if m.Command == network.CmdColor && m.Priority <= priority {
+				if err := mq.remove(key, i); err != nil {
+					return dropped, err
+				}
+				dropped++
+			}
+		}
+	}
+
+	if dropped == 0 {
+		return 0, network.ErrQueueFull
+	}
+
+	return dropped, nil
+}
+
+// Append a message to the specified queue, or to the inbox of each of a
+// topic's subscribers. Returns the number of pending messages that were
+// discarded to make room for it.
+func (mq *MessageQueue) Enqueue(key string, m network.Message) (int, error) {
+	now := time.Now()
+
+	if m.Priority < 0 || m.Priority > network.MaxPriority {
+		return 0, network.Errorf(network.CodeBadRequest, "Invalid priority: %d", m.Priority)
+	} else if m.TTL < 0 {
+		return 0, network.Errorf(network.CodeBadRequest, "Invalid TTL: %d", m.TTL)
+	} else if m.TTL > 0 && m.ExpiresAt == nil {
+		expiry := now.Add(time.Duration(m.TTL) * time.Second)
+		m.ExpiresAt = &expiry
+	}
+
+	if expired(m, now) {
+		return 0, network.ErrExpired
+	} else if m.NotBefore != nil && m.ExpiresAt != nil && !m.NotBefore.Before(*m.ExpiresAt) {
+		return 0, network.Errorf(network.CodeBadRequest, "Message would expire before it could be delivered")
+	}
+
+	mq.mutex.Lock()
+	defer mq.mutex.Unlock()
+
+	if t, ok := mq.topics[key]; ok {
+		return mq.publish(t, m, now)
+	}
+
+	return mq.enqueue(key, m, now)
+}
+
+func (mq *MessageQueue) enqueue(key string, m network.Message, now time.Time) (int, error) {
+	var dropped int
+	var err error
+
+	if err := mq.purge(key, now); err != nil {
+		return 0, err
+	}
+
+	_, exists := mq.queues[key]
+	if !exists && !mq.inboxes[key] && mq.queueCount() >= mq.maxQueues {
+		return 0, network.ErrTooManyQueues
+	}
+
+	if limits := mq.limitsOf(key); len(mq.queues[key]) >= limits.MaxDepth {
+		if dropped, err = mq.overflow(key, limits.Overflow, m.Priority); err != nil {
+			return dropped, err
+		}
+	}
+
+	m.ID = mq.nextID
+	m.Enqueued = &now
+	m.Visibility = 0
+
+	if err := mq.store.Append(key, m); err != nil {
+		return dropped, err
+	}
+
+	mq.nextID++
+	mq.queues[key] = append(mq.queues[key], m)
+	mq.notify(key)
+
+	if scheduled(m, now) {
+		mq.wakeAt(key, *m.NotBefore)
+	}
+
+	return dropped, nil
+}
+
+// Wake any readers waiting on a queue at the specified time
+func (mq *MessageQueue) wakeAt(key string, t time.Time) {
+	time.AfterFunc(time.Until(t), func() {
+		mq.mutex.Lock()
+		defer mq.mutex.Unlock()
+		mq.notify(key)
+	})
+}
+
+// Wake any readers waiting for a message to become available in a queue
+func (mq *MessageQueue) notify(key string) {
+	if arrival, ok := mq.arrivals[key]; ok {
+		close(arrival)
+		delete(mq.arrivals, key)
+	}
+}
+
 func (mq *MessageQueue) Dequeue(key string) (network.Message, error) {
 	mq.mutex.Lock()
 	defer mq.mutex.Unlock()
+	return mq.dequeue(key)
+}
+
+// Returns the highest priority message that is available for delivery,
+// discarding any that have expired or have been delivered too many times
+func (mq *MessageQueue) dequeue(key string) (network.Message, error) {
+	now := time.Now()
+	best := -1
 
-	q, exists := mq.queues[key]
-	if !exists || len(q) == 0 {
-		return network.Message{}, errors.New(network.ErrorQueueEmpty)
+	for i := 0; i < len(mq.queues[key]); i++ {
+		msg := mq.queues[key][i]
+
+		if deadline, ok := mq.inflight[msg.ID]; ok && now.Before(deadline) {
+			continue
+		} else if scheduled(msg, now) {
+			continue
+		} else if expired(msg, now) || (mq.visibility > 0 && mq.deliveries[msg.ID] >= MaxDeliveries) {
+			if err := mq.remove(key, i); err != nil {
+				return network.Message{}, err
+			}
+			i--
+			continue
+		}
+
+		if best < 0 || msg.Priority > mq.queues[key][best].Priority {
+			best = i
+		}
 	}
 
-	msg := q[0]
-	mq.queues[key] = q[1:]
-	if len(mq.queues[key]) == 0 {
-		delete(mq.queues, key)
+	if best < 0 {
+		return network.Message{}, network.ErrQueueEmpty
+	}
+
+	msg := mq.queues[key][best]
+
+	if mq.visibility <= 0 {
+		if err := mq.remove(key, best); err != nil {
+			return network.Message{}, err
+		}
+	} else {
+		mq.deliveries[msg.ID]++
+		mq.inflight[msg.ID] = now.Add(mq.visibility)
+		msg.Visibility = int((mq.visibility + time.Second - 1) / time.Second)
+
+		// Wake waiting readers once the message is visible again
+		mq.wakeAt(key, now.Add(mq.visibility))
+	}
+
+	mq.forget(key, msg.ID)
+	mq.delivered[key] = append(mq.delivered[key], msg)
+
+	// Retain as many delivered messages as the queue can hold
+	if max := mq.limitsOf(key).MaxDepth; len(mq.delivered[key]) > max {
+		mq.delivered[key] = append(queue{}, mq.delivered[key][len(mq.delivered[key])-max:]...)
 	}
 
 	return msg, nil
 }
+
+// Returns the index of the message awaiting acknowledgement with the specified ID
+func (mq *MessageQueue) find(key string, id uint64) (int, error) {
+	if _, ok := mq.inflight[id]; ok {
+		for i, m := range mq.queues[key] {
+			if m.ID == id {
+				return i, nil
+			}
+		}
+	}
+	return -1, network.ErrNoSuchMsg
+}
+
+// Delete a message that has been handled by its reader
+func (mq *MessageQueue) Ack(key string, id uint64) error {
+	mq.mutex.Lock()
+	defer mq.mutex.Unlock()
+
+	i, err := mq.find(key, id)
+	if err != nil {
+		return err
+	}
+
+	// Handled messages need not be redelivered to resuming subscribers, and
+	// are removed from the delivery history along with the message
+	return mq.remove(key, i)
+}
+
+// Remove a message from a queue's delivery history
+func (mq *MessageQueue) forget(key string, id uint64) {
+	history := queue{}
+	for _, m := range mq.delivered[key] {
+		if m.ID != id {
+			history = append(history, m)
+		}
+	}
+	mq.delivered[key] = history
+}
+
+// Make a message that its reader failed to handle available for redelivery
+func (mq *MessageQueue) Nack(key string, id uint64) error {
+	mq.mutex.Lock()
+	defer mq.mutex.Unlock()
+
+	if _, err := mq.find(key, id); err != nil {
+		return err
+	}
+
+	// The message will be dequeued again, so it must not also be replayed
+	delete(mq.inflight, id)
+	mq.forget(key, id)
+	mq.notify(key)
+	return nil
+}
+
+// Returns recently dequeued messages with IDs greater than the one specified,
+// for redelivery. Those awaiting acknowledgement are delivered anew, such that
+// they are not also redelivered once their original deadline passes.
+func (mq *MessageQueue) DeliveredSince(key string, id uint64) []network.Message {
+	mq.mutex.Lock()
+	defer mq.mutex.Unlock()
+
+	now := time.Now()
+
+	var ret []network.Message
+	for _, m := range mq.delivered[key] {
+		if m.ID <= id {
+			continue
+		}
+
+		if _, inflight := mq.inflight[m.ID]; inflight {
+			mq.deliveries[m.ID]++
+			mq.inflight[m.ID] = now.Add(mq.visibility)
+			mq.wakeAt(key, now.Add(mq.visibility))
+		}
+
+		ret = append(ret, m)
+	}
+	return ret
+}
+
+// Dequeue a message, waiting up to the specified amount of time for one to
+// arrive if the queue is empty. Waiting stops early if ctx is cancelled.
+func (mq *MessageQueue) DequeueWait(ctx context.Context, key string, wait time.Duration) (network.Message, error) {
+	if wait <= 0 {
+		return mq.Dequeue(key)
+	}
+
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+
+	for {
+		mq.mutex.Lock()
+		msg, err := mq.dequeue(key)
+		if err != network.ErrQueueEmpty {
+			mq.mutex.Unlock()
+			return msg, err
+		}
+
+		arrival, ok := mq.arrivals[key]
+		if !ok {
+			arrival = make(chan struct{})
+			mq.arrivals[key] = arrival
+		}
+		mq.mutex.Unlock()
+
+		select {
+		case <-arrival:
+		case <-timeout.C:
+			return network.Message{}, network.ErrQueueEmpty
+		case <-ctx.Done():
+			return network.Message{}, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,149 @@
+// SPDX License Identifier: MIT
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jynik/skullsup/go/src/network"
+)
+
+// Create a queue of the specified depth and overflow policy, whose messages
+// must be acknowledged
+func newTestQueue(t *testing.T, depth int, policy string) *MessageQueue {
+	mq := NewMessageQueue(4, depth)
+	if err := mq.SetLimits("q", QueueLimits{MaxDepth: depth, Overflow: policy}); err != nil {
+		t.Fatal(err)
+	}
+	mq.SetVisibilityTimeout(time.Minute)
+	return mq
+}
+
+func enqueue(t *testing.T, mq *MessageQueue, command string) uint64 {
+	if _, err := mq.Enqueue("q", network.Message{Command: command}); err != nil {
+		t.Fatal(err)
+	}
+	return mq.queues["q"][len(mq.queues["q"])-1].ID
+}
+
+func dequeue(t *testing.T, mq *MessageQueue) network.Message {
+	m, err := mq.Dequeue("q")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestOverflowSkipsInflight(t *testing.T) {
+	for _, policy := range []string{OverflowDropOldest, OverflowCoalesce} {
+		mq := newTestQueue(t, 2, policy)
+
+		first := enqueue(t, mq, network.CmdColor)
+		enqueue(t, mq, network.CmdColor)
+
+		if m := dequeue(t, mq); m.ID != first {
+			t.Fatalf("%s: expected message %d, got %d", policy, first, m.ID)
+		}
+
+		// Only the pending message may be discarded
+		if dropped, err := mq.Enqueue("q", network.Message{Command: network.CmdColor}); err != nil {
+			t.Fatalf("%s: %s", policy, err)
+		} else if dropped != 1 {
+			t.Errorf("%s: expected 1 message to be dropped, got %d", policy, dropped)
+		}
+
+		if err := mq.Ack("q", first); err != nil {
+			t.Errorf("%s: in-flight message was discarded: %s", policy, err)
+		}
+	}
+}
+
+func TestOverflowOnlyInflight(t *testing.T) {
+	for _, policy := range []string{OverflowDropOldest, OverflowCoalesce} {
+		mq := newTestQueue(t, 2, policy)
+
+		ids := []uint64{enqueue(t, mq, network.CmdColor), enqueue(t, mq, network.CmdColor)}
+		dequeue(t, mq)
+		dequeue(t, mq)
+
+		if _, err := mq.Enqueue("q", network.Message{Command: network.CmdColor}); err != network.ErrQueueFull {
+			t.Errorf("%s: expected ErrQueueFull, got %v", policy, err)
+		}
+
+		for _, id := range ids {
+			if err := mq.Ack("q", id); err != nil {
+				t.Errorf("%s: in-flight message %d was discarded: %s", policy, id, err)
+			}
+		}
+	}
+}
+
+func TestOverflowDropOldest(t *testing.T) {
+	mq := newTestQueue(t, 2, OverflowDropOldest)
+
+	enqueue(t, mq, network.CmdIncant)
+	second := enqueue(t, mq, network.CmdIncant)
+	third := enqueue(t, mq, network.CmdIncant)
+
+	for _, id := range []uint64{second, third} {
+		if m := dequeue(t, mq); m.ID != id {
+			t.Errorf("Expected message %d, got %d", id, m.ID)
+		}
+	}
+}
+
+func TestDeliveredSince(t *testing.T) {
+	mq := newTestQueue(t, 4, OverflowReject)
+
+	acked := enqueue(t, mq, network.CmdIncant)
+	nacked := enqueue(t, mq, network.CmdIncant)
+	inflight := enqueue(t, mq, network.CmdIncant)
+	for i := 0; i < 3; i++ {
+		dequeue(t, mq)
+	}
+
+	if err := mq.Ack("q", acked); err != nil {
+		t.Fatal(err)
+	} else if err := mq.Nack("q", nacked); err != nil {
+		t.Fatal(err)
+	}
+
+	// The subscriber lost its connection, and resumes after the deadline of
+	// the message it did not receive has passed
+	mq.inflight[inflight] = time.Now()
+
+	replayed := mq.DeliveredSince("q", 0)
+	if len(replayed) != 1 || replayed[0].ID != inflight {
+		t.Fatalf("Expected only message %d to be replayed, got %v", inflight, replayed)
+	}
+
+	// The nacked message is delivered once more, but the replayed message
+	// must not be redelivered until its new deadline passes
+	if m := dequeue(t, mq); m.ID != nacked {
+		t.Errorf("Expected message %d, got %d", nacked, m.ID)
+	}
+
+	if m, err := mq.Dequeue("q"); err != network.ErrQueueEmpty {
+		t.Errorf("Replayed message %d was also redelivered", m.ID)
+	}
+
+	if err := mq.Ack("q", inflight); err != nil {
+		t.Error(err)
+	} else if replayed := mq.DeliveredSince("q", inflight-1); len(replayed) != 0 {
+		t.Errorf("Acknowledged message was replayed: %v", replayed)
+	}
+}
+
+func TestDeliveredSinceUnacknowledged(t *testing.T) {
+	mq := NewMessageQueue(4, 4)
+
+	first := enqueue(t, mq, network.CmdIncant)
+	second := enqueue(t, mq, network.CmdIncant)
+	dequeue(t, mq)
+	dequeue(t, mq)
+
+	replayed := mq.DeliveredSince("q", first)
+	if len(replayed) != 1 || replayed[0].ID != second {
+		t.Errorf("Expected message %d to be replayed, got %v", second, replayed)
+	}
+}
@@ -7,9 +7,12 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/jynik/skullsup/go/src/logger"
 	"github.com/jynik/skullsup/go/src/network"
@@ -32,10 +35,48 @@ type handlerContext struct {
 	user   *network.User
 	queue  string
 	source string
+
+	// Queue from which the user reads, which differs from the requested
+	// queue for topics
+	inbox string
+
+	// Message being acknowledged, per action
+	id     uint64
+	action string
+
+	// Requested read-only view of the queue
+	view string
+}
+
+// Largest message that may be written to a queue, in bytes
+const maxMessageSize = 16384
+
+// Returned in place of errors whose details are only of interest to the server
+var errInternal = &network.Error{Code: network.CodeInternal, Message: "I've descended into maddness."}
+
+var errMethod = &network.Error{Code: network.CodeMethodNotAllowed, Message: "Shub-Niggurath!"}
+
+// Respond with an error, described by a JSON body. Empty queues are
+// indicated solely by the response status.
+func writeError(w http.ResponseWriter, e *network.Error) {
+	if e.Code == network.CodeQueueEmpty {
+		w.WriteHeader(e.Status())
+		return
+	}
+
+	body, err := json.Marshal(e)
+	if err != nil {
+		body = []byte(`{"code":"internal"}`)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(e.Status())
+	w.Write(append(body, '\n'))
 }
 
 func (s *Server) errorForbidden(w http.ResponseWriter, source string, reason string) {
-	http.Error(w, "ph'nglui mglw'nafh Cthulhu R'lyeh wgah'nagl fhtagn", http.StatusForbidden)
+	writeError(w, &network.Error{Code: network.CodeForbidden, Message: "ph'nglui mglw'nafh Cthulhu R'lyeh wgah'nagl fhtagn"})
 
 	if reason != "" {
 		reason = ": " + reason
@@ -50,34 +91,50 @@ func (s *Server) handleQueueWrite(ctx *handlerContext) {
 		return
 	}
 
-	if ctx.r.ContentLength < 1 {
-		s.log.Error("No content received from %s\n", ctx.source)
-		http.Error(ctx.w, "Empty queue message received", 400)
-		return
-	} else if ctx.r.ContentLength > 16384 {
+	tooLarge := &network.Error{Code: network.CodeTooLarge, Message: "You're not worthy of such a grand request."}
+	if ctx.r.ContentLength > maxMessageSize {
 		s.log.Error("Excessively large reuqest (%d) from %s\n", ctx.r.ContentLength, ctx.source)
-		http.Error(ctx.w, "You're not worthy of such a grand request.", 413)
+		writeError(ctx.w, tooLarge)
 		return
 	}
 
+	// The length is not known in advance if the body is chunked
 	defer ctx.r.Body.Close()
-	body, err := ioutil.ReadAll(ctx.r.Body)
+	body, err := ioutil.ReadAll(io.LimitReader(ctx.r.Body, maxMessageSize+1))
 	if err != nil {
 		s.log.Error("Failed to read body in request from %s: %s\n", ctx.source, err.Error())
-		http.Error(ctx.w, "I've descended into maddness.", 500)
+		writeError(ctx.w, errInternal)
+		return
+	} else if len(body) > maxMessageSize {
+		s.log.Error("Excessively large reuqest from %s\n", ctx.source)
+		writeError(ctx.w, tooLarge)
+		return
+	} else if len(body) == 0 {
+		s.log.Error("No content received from %s\n", ctx.source)
+		writeError(ctx.w, network.Errorf(network.CodeBadRequest, "Empty queue message received"))
 		return
 	}
 
 	var msg network.Message
 	if err := json.Unmarshal(body, &msg); err != nil {
 		s.log.Error("Received invalid message from %s\n", ctx.source)
-		http.Error(ctx.w, "Your ramblings are incomrehensible!", 400)
+		writeError(ctx.w, network.Errorf(network.CodeBadRequest, "Your ramblings are incomrehensible!"))
+		return
+	}
+
+	if !ctx.user.CanPrioritize(msg.Priority) {
+		s.errorForbidden(ctx.w, ctx.source, fmt.Sprintf("User may not write messages of priority %d.", msg.Priority))
 		return
 	}
 
-	if err := s.q.Enqueue(ctx.queue, msg); err != nil {
+	dropped, err := s.q.Enqueue(ctx.queue, msg)
+	if dropped > 0 {
+		s.log.Info("Queue %s full. Discarded %d message(s) to make room for %s\n", ctx.queue, dropped, ctx.source)
+	}
+
+	if err != nil {
 		// Avoid filling logs with duplicate back-to-back error
-		if err.Error() == network.ErrorQueueFull {
+		if err == network.ErrQueueFull {
 			if !s.queueFullLogged {
 				s.log.Error("Queue full. Dropping enqueue request(s) from: %s\n", ctx.source)
 				s.queueFullLogged = true
@@ -88,7 +145,12 @@ func (s *Server) handleQueueWrite(ctx *handlerContext) {
 			s.log.Error("Enqueue from %s failed: %s\n", ctx.source, err)
 			s.queueFullLogged = false
 		}
-		http.Error(ctx.w, err.Error(), 666)
+
+		if e, ok := err.(*network.Error); ok {
+			writeError(ctx.w, e)
+		} else {
+			writeError(ctx.w, errInternal)
+		}
 		return
 	}
 	s.queueFullLogged = false
@@ -101,21 +163,38 @@ func (s *Server) handleQueueRead(ctx *handlerContext) {
 		return
 	}
 
-	msg, err := s.q.Dequeue(ctx.queue)
-	if err != nil {
-		if err.Error() == network.ErrorQueueEmpty {
-			if !s.queueEmptyLogged {
-				s.log.Error("Queue empty. Dropping dequeue request(s) from: %s\n", ctx.source)
-				s.queueEmptyLogged = true
-			} else {
-				s.log.Debug("Queue empty. Dropping dequeue request(s) from: %s\n", ctx.source)
-			}
+	var wait time.Duration
+	if param := ctx.r.URL.Query().Get(network.WaitParam); param != "" {
+		var err error
+		if wait, err = network.ParseWait(param); err != nil {
+			s.log.Error("Invalid wait from %s: %s\n", ctx.source, param)
+			writeError(ctx.w, network.Errorf(network.CodeBadRequest, "Time is meaningless to the Old Ones, but not like that."))
+			return
+		}
+
+		if max := time.Duration(s.cfg.MaxWait) * time.Second; wait > max {
+			wait = max
+		}
+	}
+
+	msg, err := s.q.DequeueWait(ctx.r.Context(), ctx.inbox, wait)
+	if err != nil && ctx.r.Context().Err() != nil {
+		s.log.Debug("%s abandoned its wait for a message\n", ctx.source)
+		return
+	} else if err == network.ErrQueueEmpty {
+		if !s.queueEmptyLogged {
+			s.log.Error("Queue empty. Dropping dequeue request(s) from: %s\n", ctx.source)
+			s.queueEmptyLogged = true
 		} else {
-			s.log.Error("Dequeue for %s failed: %s\n", ctx.source, err)
-			s.queueEmptyLogged = false
+			s.log.Debug("Queue empty. Dropping dequeue request(s) from: %s\n", ctx.source)
 		}
 
-		http.Error(ctx.w, err.Error(), 666)
+		writeError(ctx.w, network.ErrQueueEmpty)
+		return
+	} else if err != nil {
+		s.log.Error("Dequeue for %s failed: %s\n", ctx.source, err)
+		s.queueEmptyLogged = false
+		writeError(ctx.w, errInternal)
 		return
 	}
 	s.queueEmptyLogged = false
@@ -124,10 +203,95 @@ func (s *Server) handleQueueRead(ctx *handlerContext) {
 	if body, err := json.Marshal(msg); err != nil {
 		s.log.Error("Failed to marshal message for %s: %s\n", ctx.source, err)
 		s.log.Error(" Message was: %s\n", msg.String())
-		http.Error(ctx.w, "I've descended into maddness.", 500)
-	} else if _, err := ctx.w.Write(body); err != nil {
-		s.log.Error("Failed to write message to %s: %s\n", ctx.source, err)
-		http.Error(ctx.w, "I have faltered, oh Dark One.", 500)
+		writeError(ctx.w, errInternal)
+	} else {
+		ctx.w.Header().Set("Content-Type", "application/json")
+		if _, err := ctx.w.Write(body); err != nil {
+			s.log.Error("Failed to write message to %s: %s\n", ctx.source, err)
+		}
+	}
+}
+
+func (s *Server) handleQueueAck(ctx *handlerContext) {
+	if !ctx.user.CanRead(ctx.queue) {
+		s.errorForbidden(ctx.w, ctx.source, "User does not have reader access to requested queue.")
+		return
+	}
+
+	var err error
+	if ctx.action == network.ActionAck {
+		err = s.q.Ack(ctx.inbox, ctx.id)
+	} else {
+		err = s.q.Nack(ctx.inbox, ctx.id)
+	}
+
+	if err == network.ErrNoSuchMsg {
+		s.log.Debug("%s sent %s for unknown message #%d\n", ctx.source, ctx.action, ctx.id)
+		writeError(ctx.w, network.ErrNoSuchMsg)
+		return
+	} else if err != nil {
+		s.log.Error("Failed to %s message #%d for %s: %s\n", ctx.action, ctx.id, ctx.source, err)
+		writeError(ctx.w, errInternal)
+		return
+	}
+
+	s.log.Debug("%s sent %s for message #%d\n", ctx.source, ctx.action, ctx.id)
+}
+
+func (s *Server) writeJSON(ctx *handlerContext, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		s.log.Error("Failed to marshal response for %s: %s\n", ctx.source, err)
+		writeError(ctx.w, errInternal)
+		return
+	}
+
+	ctx.w.Header().Set("Content-Type", "application/json")
+	if _, err := ctx.w.Write(body); err != nil {
+		s.log.Error("Failed to write response to %s: %s\n", ctx.source, err)
+	}
+}
+
+// List the queues the user may access
+func (s *Server) handleQueueList(ctx *handlerContext) {
+	queues := []network.QueueStatus{}
+	listed := map[string]bool{}
+
+	for _, name := range append(ctx.user.ReadQueues, ctx.user.WriteQueues...) {
+		if listed[name] {
+			continue
+		}
+		listed[name] = true
+
+		status := s.q.Status(name)
+		status.Read = ctx.user.CanRead(name)
+		status.Write = ctx.user.CanWrite(name)
+		queues = append(queues, status)
+	}
+
+	s.writeJSON(ctx, queues)
+}
+
+func (s *Server) handleQueueView(ctx *handlerContext) {
+	if !ctx.user.CanRead(ctx.queue) && !ctx.user.CanWrite(ctx.queue) {
+		s.errorForbidden(ctx.w, ctx.source, "User does not have access to requested queue.")
+		return
+	}
+
+	switch ctx.view {
+	case network.ViewStatus:
+		status := s.q.Status(ctx.queue)
+		status.Read = ctx.user.CanRead(ctx.queue)
+		status.Write = ctx.user.CanWrite(ctx.queue)
+		s.writeJSON(ctx, status)
+
+	case network.ViewPeek:
+		// Only subscribers have an inbox to peek into
+		if ctx.inbox != ctx.queue && !ctx.user.CanRead(ctx.queue) {
+			s.errorForbidden(ctx.w, ctx.source, "User is not subscribed to requested topic.")
+			return
+		}
+		s.writeJSON(ctx, s.q.Peek(ctx.inbox))
 	}
 }
 
@@ -162,6 +326,17 @@ func (s *Server) handleQueueRequest(w http.ResponseWriter, r *http.Request) {
 	source := fmt.Sprintf("%s@%s <%s>", user.Name, r.RemoteAddr, user.CertSerial)
 	s.log.Debug("Handling request from: %s\n", source)
 
+	if strings.TrimSuffix(r.URL.Path, "/") == "/"+network.QueueEndpoint {
+		if r.Method != http.MethodGet {
+			writeError(w, errMethod)
+			s.log.Error("%s@%s sent an invalid method.\n", user.Name, r.RemoteAddr)
+			return
+		}
+
+		s.handleQueueList(&handlerContext{w: w, r: r, user: user, source: source})
+		return
+	}
+
 	queue := network.QueueFromURL(r.URL.Path)
 	if queue == "" {
 		// 403 instead of 404 to avoid enumerating other users' queues
@@ -172,16 +347,39 @@ func (s *Server) handleQueueRequest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := handlerContext{w: w, r: r, user: user, queue: queue, source: source}
+	if name, id, action, ok := network.SplitMessageAction(queue); ok {
+		ctx.queue, ctx.id, ctx.action = name, id, action
+	} else if name, view, ok := network.SplitQueueView(queue); ok {
+		ctx.queue, ctx.view = name, view
+	}
+	ctx.inbox = s.q.Inbox(ctx.queue, user.Name)
+
+	// Acknowledgements are POSTed to a message's URL, and nothing else is.
+	// Views are read-only.
+	if (ctx.action != "") != (r.Method == http.MethodPost) || (ctx.view != "" && r.Method != http.MethodGet) {
+		writeError(w, errMethod)
+		s.log.Error("%s@%s sent an invalid method.\n", user.Name, r.RemoteAddr)
+		return
+	}
 
 	switch r.Method {
+	case http.MethodPost:
+		s.handleQueueAck(&ctx)
+
 	case http.MethodPut:
 		s.handleQueueWrite(&ctx)
 
 	case http.MethodGet:
-		s.handleQueueRead(&ctx)
+		if ctx.view != "" {
+			s.handleQueueView(&ctx)
+		} else if wantsStream(r) {
+			s.handleQueueSubscribe(&ctx)
+		} else {
+			s.handleQueueRead(&ctx)
+		}
 
 	default:
-		http.Error(w, "Shub-Niggurath!", http.StatusMethodNotAllowed)
+		writeError(w, errMethod)
 		s.log.Error("%s@%s sent an invalid method.\n", user.Name, r.RemoteAddr)
 	}
 }
@@ -195,17 +393,74 @@ func New(filename string) (*Server, error) {
 		return nil, err
 	}
 
-	//  TODO Make configurable
-	server.q = NewMessageQueue(10, 16)
-
 	server.log, err = logger.New(server.cfg.LogPath, server.cfg.LogLevel)
 	if err != nil {
 		return nil, err
 	}
 
+	store, err := server.cfg.Storage.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	server.q, err = OpenMessageQueue(server.cfg.MaxQueues, server.cfg.QueueLimits, store)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	server.q.SetVisibilityTimeout(time.Duration(server.cfg.VisibilityTimeout) * time.Second)
+
+	for name, limits := range server.cfg.Queues {
+		if err := server.q.SetLimits(name, limits); err != nil {
+			server.q.Close()
+			return nil, err
+		}
+	}
+
+	for name, limits := range server.cfg.Topics {
+		var subscribers []string
+		for _, user := range server.cfg.Users {
+			if user.CanRead(name) {
+				subscribers = append(subscribers, user.Name)
+			}
+		}
+
+		if err := server.q.AddTopic(name, subscribers, limits); err != nil {
+			server.q.Close()
+			return nil, err
+		}
+
+		server.log.Debug("Topic %s has subscribers: %s\n", name, strings.Join(subscribers, ", "))
+	}
+
+	// Inboxes of topics and subscribers that have since been removed from
+	// the configuration must not be restored as ordinary queues
+	queues := map[string]bool{}
+	for _, user := range server.cfg.Users {
+		for _, queue := range append(user.ReadQueues, user.WriteQueues...) {
+			queues[queue] = true
+		}
+	}
+
+	discarded, err := server.q.DiscardInboxes(queues)
+	if err != nil {
+		server.q.Close()
+		return nil, err
+	}
+
+	for _, inbox := range discarded {
+		server.log.Info("Discarded messages of orphaned inbox %s\n", inbox)
+	}
+
+	if server.cfg.Storage.Path != "" {
+		server.log.Info("Persisting queues to %s (fsync: %s)\n", server.cfg.Storage.Path, server.cfg.Storage.Fsync)
+	}
+
 	// Load CA certificate that is used to verify client certs
 	caCert, err := ioutil.ReadFile(server.cfg.CAPath)
 	if err != nil {
+		server.q.Close()
 		return nil, err
 	}
 
@@ -234,5 +489,18 @@ func (s *Server) Run() error {
 	addr := s.cfg.Address + ":" + strconv.Itoa(int(s.cfg.Port))
 	s.log.Info("Starting SkullsUp! server on " + addr + "\n")
 
-	return s.impl.ListenAndServeTLS(s.cfg.CertPath, s.cfg.KeyPath)
+	err := s.impl.ListenAndServeTLS(s.cfg.CertPath, s.cfg.KeyPath)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// Stop the server, flushing any queued messages to storage
+func (s *Server) Close() error {
+	err := s.impl.Close()
+	if qErr := s.q.Close(); err == nil {
+		err = qErr
+	}
+	return err
 }
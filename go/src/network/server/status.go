@@ -0,0 +1,91 @@
+// SPDX License Identifier: MIT
+package server
+
+import (
+	"sort"
+	"time"
+
+	"github.com/jynik/skullsup/go/src/network"
+)
+
+func (mq *MessageQueue) status(key string, now time.Time) network.QueueStatus {
+	s := network.QueueStatus{Name: key, MaxDepth: mq.limitsOf(key).MaxDepth}
+
+	for _, m := range mq.queues[key] {
+		if expired(m, now) {
+			continue
+		}
+
+		s.Depth++
+		if deadline, ok := mq.inflight[m.ID]; ok && now.Before(deadline) {
+			s.InFlight++
+		} else if scheduled(m, now) {
+			s.Scheduled++
+		}
+
+		if m.Enqueued != nil {
+			if age := now.Sub(*m.Enqueued).Seconds(); age > s.OldestAge {
+				s.OldestAge = age
+			}
+		}
+	}
+
+	return s
+}
+
+// Summarize the contents of a queue or topic
+func (mq *MessageQueue) Status(name string) network.QueueStatus {
+	mq.mutex.Lock()
+	defer mq.mutex.Unlock()
+
+	now := time.Now()
+
+	t, ok := mq.topics[name]
+	if !ok {
+		return mq.status(name, now)
+	}
+
+	s := network.QueueStatus{Name: name, Topic: true}
+	for _, subscriber := range t.subscribers {
+		inbox := mq.status(inboxKey(name, subscriber), now)
+		inbox.Name = subscriber
+
+		s.Depth += inbox.Depth
+		s.MaxDepth += inbox.MaxDepth
+		s.InFlight += inbox.InFlight
+		s.Scheduled += inbox.Scheduled
+		if inbox.OldestAge > s.OldestAge {
+			s.OldestAge = inbox.OldestAge
+		}
+
+		s.Subscribers = append(s.Subscribers, inbox)
+	}
+
+	return s
+}
+
+// Returns the messages in a queue that are awaiting delivery, in the order
+// they will be delivered, without removing them
+func (mq *MessageQueue) Peek(key string) []network.Message {
+	mq.mutex.Lock()
+	defer mq.mutex.Unlock()
+
+	now := time.Now()
+	ret := []network.Message{}
+
+	for _, m := range mq.queues[key] {
+		if deadline, ok := mq.inflight[m.ID]; ok && now.Before(deadline) {
+			continue
+		} else if !expired(m, now) {
+			ret = append(ret, m)
+		}
+	}
+
+	// Messages that are scheduled for later delivery are listed in the
+	// order they would be delivered if they were already due.
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Priority > ret[j].Priority
+	})
+
+	return ret
+}
@@ -0,0 +1,97 @@
+// SPDX License Identifier: MIT
+package server
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jynik/skullsup/go/src/network"
+)
+
+// Storage backend for queued messages. Changes to a MessageQueue are
+// recorded by its Store before they are applied in memory, such that the
+// queues can be restored by Load() after the server restarts.
+type Store interface {
+	// Record that a message was appended to the end of a queue
+	Append(queue string, m network.Message) error
+
+	// Record that the message at the specified index of a queue was removed
+	Remove(queue string, index int) error
+
+	// Load the contents of all queues, with the oldest message first
+	Load() (map[string][]network.Message, error)
+
+	Close() error
+}
+
+// Store that only retains messages in memory
+type memoryStore struct{}
+
+func (s memoryStore) Append(queue string, m network.Message) error {
+	return nil
+}
+
+func (s memoryStore) Remove(queue string, index int) error {
+	return nil
+}
+
+func (s memoryStore) Load() (map[string][]network.Message, error) {
+	return map[string][]network.Message{}, nil
+}
+
+func (s memoryStore) Close() error {
+	return nil
+}
+
+// Policies for flushing the write-ahead log to disk
+const (
+	FsyncAlways   = "always"   // After every write
+	FsyncInterval = "interval" // Periodically, per StorageConfig.FsyncInterval
+	FsyncNever    = "never"    // Whenever the operating system sees fit
+)
+
+// Default period, in ms, of the "interval" fsync policy
+const DefaultFsyncInterval = 1000
+
+type StorageConfig struct {
+	// Path to the write-ahead log in which queued messages are persisted.
+	// If empty, messages are only held in memory and are lost when the
+	// server exits.
+	Path string `json:"path"`
+
+	// When to flush the log to disk: "always", "interval", or "never".
+	// Defaults to "always".
+	Fsync string `json:"fsync"`
+
+	// Flush period, in ms, used by the "interval" policy
+	FsyncInterval int `json:"fsync_interval"`
+}
+
+func (c *StorageConfig) validate() error {
+	c.Fsync = strings.ToLower(c.Fsync)
+
+	switch c.Fsync {
+	case "":
+		c.Fsync = FsyncAlways
+	case FsyncAlways, FsyncInterval, FsyncNever:
+	default:
+		return fmt.Errorf("Invalid fsync policy: %s", c.Fsync)
+	}
+
+	if c.FsyncInterval < 0 {
+		return fmt.Errorf("Invalid fsync interval: %d", c.FsyncInterval)
+	} else if c.FsyncInterval == 0 {
+		c.FsyncInterval = DefaultFsyncInterval
+	}
+
+	return nil
+}
+
+// Open the storage backend described by the configuration
+func (c *StorageConfig) Open() (Store, error) {
+	if c.Path == "" {
+		return memoryStore{}, nil
+	}
+	return OpenLog(c.Path, c.Fsync, time.Duration(c.FsyncInterval)*time.Millisecond)
+}
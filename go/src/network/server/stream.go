@@ -0,0 +1,113 @@
+// SPDX License Identifier: MIT
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jynik/skullsup/go/src/network"
+)
+
+// Returns true if the request asks to subscribe to a stream of events
+func wantsStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), network.EventStream)
+}
+
+// Write a single Server-Sent Event
+func writeEvent(w http.ResponseWriter, id uint64, event string, data []byte) error {
+	var err error
+
+	if id != 0 {
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, event, data)
+	} else {
+		_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	}
+
+	if err == nil {
+		w.(http.Flusher).Flush()
+	}
+	return err
+}
+
+func (s *Server) sendMessage(ctx *handlerContext, msg network.Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		s.log.Error("Failed to marshal message for %s: %s\n", ctx.source, err)
+		s.log.Error(" Message was: %s\n", msg.String())
+		return err
+	}
+
+	if err := writeEvent(ctx.w, msg.ID, network.EventMessage, body); err != nil {
+		s.log.Error("Failed to send message #%d to %s: %s\n", msg.ID, ctx.source, err)
+		return err
+	}
+
+	s.log.Debug("Sent message to %s: %s\n", ctx.source, msg.String())
+	return nil
+}
+
+// Stream messages to a subscriber as they are enqueued. If the subscriber
+// provides the ID of the last message it received, any messages dequeued
+// after it are redelivered first, as they may have been lost along with the
+// subscriber's previous connection.
+func (s *Server) handleQueueSubscribe(ctx *handlerContext) {
+	if !ctx.user.CanRead(ctx.queue) {
+		s.errorForbidden(ctx.w, ctx.source, "User does not have reader access to requested queue.")
+		return
+	}
+
+	if _, ok := ctx.w.(http.Flusher); !ok {
+		s.log.Error("Cannot stream events to %s\n", ctx.source)
+		writeError(ctx.w, &network.Error{Code: network.CodeInternal, Message: "The stars are not right."})
+		return
+	}
+
+	var backlog []network.Message
+	if lastID := ctx.r.Header.Get(network.LastEventID); lastID != "" {
+		id, err := strconv.ParseUint(lastID, 10, 64)
+		if err != nil {
+			s.log.Error("Invalid %s from %s: %s\n", network.LastEventID, ctx.source, lastID)
+			writeError(ctx.w, network.Errorf(network.CodeBadRequest, "No such soul has passed through here."))
+			return
+		}
+
+		backlog = s.q.DeliveredSince(ctx.inbox, id)
+		s.log.Debug("%s resuming after #%d (%d to redeliver)\n", ctx.source, id, len(backlog))
+	}
+
+	ctx.w.Header().Set("Content-Type", network.EventStream)
+	ctx.w.Header().Set("Cache-Control", "no-cache")
+	ctx.w.WriteHeader(http.StatusOK)
+	ctx.w.(http.Flusher).Flush()
+
+	s.log.Info("%s subscribed to %s\n", ctx.source, ctx.queue)
+	defer s.log.Info("%s unsubscribed from %s\n", ctx.source, ctx.queue)
+
+	for _, msg := range backlog {
+		if err := s.sendMessage(ctx, msg); err != nil {
+			return
+		}
+	}
+
+	for /*ever!*/ {
+		msg, err := s.q.DequeueWait(ctx.r.Context(), ctx.inbox, network.Heartbeat)
+		if ctx.r.Context().Err() != nil {
+			return
+		} else if err == network.ErrQueueEmpty {
+			if _, err := fmt.Fprint(ctx.w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			ctx.w.(http.Flusher).Flush()
+		} else if err != nil {
+			s.log.Error("Dequeue for %s failed: %s\n", ctx.source, err)
+			body, _ := json.Marshal(errInternal)
+			writeEvent(ctx.w, 0, network.EventError, body)
+			return
+		} else if err := s.sendMessage(ctx, msg); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,138 @@
+// SPDX License Identifier: MIT
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jynik/skullsup/go/src/network"
+)
+
+// Separates a topic's name from a subscriber's name in the key of the
+// subscriber's inbox
+const inboxSeparator = "/"
+
+// A topic delivers each message written to it to every subscriber. Each
+// subscriber reads from its own inbox, which tracks its progress through
+// the topic's messages independently of other subscribers.
+type topic struct {
+	name        string
+	subscribers []string
+}
+
+func inboxKey(topic, subscriber string) string {
+	return topic + inboxSeparator + subscriber
+}
+
+// Returns true if the specified queue name refers to a topic's inbox
+func isInbox(name string, topics map[string]QueueLimits) bool {
+	for t := range topics {
+		if strings.HasPrefix(name, t+inboxSeparator) {
+			return true
+		}
+	}
+	return false
+}
+
+// Create a topic, with the specified limits applied to each subscriber's
+// inbox. Unspecified limits are taken from the MessageQueue's defaults.
+func (mq *MessageQueue) AddTopic(name string, subscribers []string, limits QueueLimits) error {
+	mq.mutex.Lock()
+	defer mq.mutex.Unlock()
+
+	limits = limits.inherit(mq.limits)
+	if err := limits.validate(); err != nil {
+		return fmt.Errorf("Topic \"%s\": %s", name, err)
+	}
+
+	t := &topic{name: name}
+	for _, s := range subscribers {
+		key := inboxKey(name, s)
+		mq.inboxes[key] = true
+		mq.overrides[key] = limits
+		t.subscribers = append(t.subscribers, s)
+	}
+
+	mq.topics[name] = t
+	return nil
+}
+
+// Discard the restored messages of inboxes that no longer belong to a
+// configured topic and subscriber, which would otherwise be treated as
+// ordinary queues. Inboxes are not distinguished from queues in the Store,
+// so any queue whose name contains the inbox separator is assumed to be one,
+// unless it is among the specified queues. Returns the inboxes discarded.
+func (mq *MessageQueue) DiscardInboxes(queues map[string]bool) ([]string, error) {
+	mq.mutex.Lock()
+	defer mq.mutex.Unlock()
+
+	var ret []string
+	for key := range mq.queues {
+		if mq.inboxes[key] || queues[key] || !strings.Contains(key, inboxSeparator) {
+			continue
+		}
+
+		for len(mq.queues[key]) > 0 {
+			if err := mq.remove(key, len(mq.queues[key])-1); err != nil {
+				return ret, err
+			}
+		}
+
+		delete(mq.delivered, key)
+		ret = append(ret, key)
+	}
+
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// Returns the queue from which a reader receives messages. For topics, this
+// is the reader's inbox, and otherwise the queue itself.
+func (mq *MessageQueue) Inbox(name, reader string) string {
+	mq.mutex.Lock()
+	defer mq.mutex.Unlock()
+
+	if _, ok := mq.topics[name]; ok {
+		return inboxKey(name, reader)
+	}
+	return name
+}
+
+// Number of queues, excluding topic inboxes
+func (mq *MessageQueue) queueCount() int {
+	n := 0
+	for key := range mq.queues {
+		if !mq.inboxes[key] {
+			n++
+		}
+	}
+	return n
+}
+
+// Deliver a message to each of a topic's subscribers. This fails only if
+// the message could not be delivered to any subscriber.
+func (mq *MessageQueue) publish(t *topic, m network.Message, now time.Time) (int, error) {
+	var firstErr error
+	delivered, dropped := 0, 0
+
+	for _, s := range t.subscribers {
+		n, err := mq.enqueue(inboxKey(t.name, s), m, now)
+		dropped += n
+
+		if err == nil {
+			delivered++
+		} else if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if delivered == 0 && firstErr != nil {
+		return dropped, firstErr
+	} else if len(t.subscribers) == 0 {
+		return 0, network.Errorf(network.CodeNotFound, "Topic has no subscribers")
+	}
+
+	return dropped, nil
+}
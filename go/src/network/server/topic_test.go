@@ -0,0 +1,64 @@
+// SPDX License Identifier: MIT
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jynik/skullsup/go/src/network"
+)
+
+func TestDiscardInboxes(t *testing.T) {
+	path, cleanup := tempLog(t)
+	defer cleanup()
+
+	store := openLog(t, path)
+	for i, key := range []string{"news/alice", "news/carol", "old/bob", "team/x", "plain"} {
+		if err := store.Append(key, msg(uint64(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	limits := QueueLimits{MaxDepth: 4, Overflow: OverflowReject}
+	mq, err := OpenMessageQueue(3, limits, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mq.AddTopic("news", []string{"alice"}, QueueLimits{}); err != nil {
+		t.Fatal(err)
+	}
+
+	discarded, err := mq.DiscardInboxes(map[string]bool{"team/x": true})
+	if err != nil {
+		t.Fatal(err)
+	} else if want := []string{"news/carol", "old/bob"}; !reflect.DeepEqual(discarded, want) {
+		t.Errorf("Expected %v to be discarded, got %v", want, discarded)
+	}
+
+	if _, err := mq.Dequeue("old/bob"); err != network.ErrQueueEmpty {
+		t.Errorf("Orphaned inbox is still readable: %v", err)
+	}
+
+	// Only the ordinary queues count toward the limit
+	if _, err := mq.Enqueue("another", network.Message{Command: network.CmdIncant}); err != nil {
+		t.Errorf("Orphaned inboxes counted toward the queue limit: %s", err)
+	}
+
+	mq.Close()
+
+	store = openLog(t, path)
+	defer store.Close()
+
+	queues := load(t, store)
+	for _, key := range discarded {
+		if _, ok := queues[key]; ok {
+			t.Errorf("%s was restored after being discarded", key)
+		}
+	}
+	for _, key := range []string{"news/alice", "team/x", "plain", "another"} {
+		if _, ok := queues[key]; !ok {
+			t.Errorf("%s was not restored", key)
+		}
+	}
+}
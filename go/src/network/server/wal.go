@@ -0,0 +1,312 @@
+// SPDX License Identifier: MIT
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jynik/skullsup/go/src/network"
+)
+
+// Write-ahead log operations
+const (
+	opAppend = "append"
+	opRemove = "remove"
+)
+
+type logRecord struct {
+	Op    string           `json:"op"`
+	Queue string           `json:"queue"`
+	Index int              `json:"index,omitempty"`
+	Msg   *network.Message `json:"msg,omitempty"`
+}
+
+// The log is compacted once it contains at least this many records, and
+// more than compactRatio records per queued message.
+const (
+	compactThreshold = 1024
+	compactRatio     = 4
+)
+
+// Store backed by an append-only write-ahead log, with one JSON record per
+// line. The log is replayed and compacted when it is opened, and compacted
+// again whenever it grows sufficiently large.
+type logStore struct {
+	mutex   sync.Mutex
+	path    string
+	file    *os.File
+	fsync   string
+	dirty   bool // Records have been written since the last fsync
+	records int  // Number of records in the log
+	done    chan struct{}
+
+	// Current contents of the queues, used for compaction
+	queues map[string][]network.Message
+}
+
+// Open a write-ahead log, creating it if it does not exist. The fsync policy
+// must be one of FsyncAlways, FsyncInterval or FsyncNever.
+func OpenLog(path string, fsync string, interval time.Duration) (Store, error) {
+	s := &logStore{
+		path:   path,
+		fsync:  fsync,
+		done:   make(chan struct{}),
+		queues: map[string][]network.Message{},
+	}
+
+	if err := s.replay(); err != nil {
+		return nil, err
+	}
+
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+
+	if fsync == FsyncInterval {
+		go s.syncPeriodically(interval)
+	}
+
+	return s, nil
+}
+
+func (s *logStore) apply(r logRecord) error {
+	switch r.Op {
+	case opAppend:
+		if r.Msg == nil {
+			return fmt.Errorf("Append record for \"%s\" has no message", r.Queue)
+		}
+		s.queues[r.Queue] = append(s.queues[r.Queue], *r.Msg)
+
+	case opRemove:
+		q := s.queues[r.Queue]
+		if r.Index < 0 || r.Index >= len(q) {
+			return fmt.Errorf("Remove record for non-existent message %d in \"%s\"", r.Index, r.Queue)
+		} else if len(q) == 1 {
+			delete(s.queues, r.Queue)
+		} else {
+			s.queues[r.Queue] = append(q[:r.Index:r.Index], q[r.Index+1:]...)
+		}
+
+	default:
+		return fmt.Errorf("Invalid operation: %s", r.Op)
+	}
+
+	return nil
+}
+
+// Rebuild the queues from the log. A truncated final record, as left by a
+// crash partway through a write, is discarded.
+func (s *logStore) replay() error {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		var record logRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return fmt.Errorf("%s:%d: Corrupt record: %s", s.path, n, err)
+		} else if err := s.apply(record); err != nil {
+			return fmt.Errorf("%s:%d: %s", s.path, n, err)
+		}
+	}
+}
+
+// Replace the log with the minimal set of records needed to reproduce the
+// current queues.
+func (s *logStore) compact() error {
+	var buf bytes.Buffer
+	records := 0
+
+	for queue, msgs := range s.queues {
+		for i := range msgs {
+			line, err := json.Marshal(logRecord{Op: opAppend, Queue: queue, Msg: &msgs[i]})
+			if err != nil {
+				return err
+			}
+			buf.Write(append(line, '\n'))
+			records++
+		}
+	}
+
+	tmpPath := s.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	} else if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	} else if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return err
+	}
+
+	// Ensure the rename itself is durable
+	if dir, err := os.Open(filepath.Dir(s.path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	if s.file != nil {
+		s.file.Close()
+	}
+
+	s.file, err = os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	s.records = records
+	s.dirty = false
+	return nil
+}
+
+func (s *logStore) live() int {
+	n := 0
+	for _, q := range s.queues {
+		n += len(q)
+	}
+	return n
+}
+
+// Append a record to the log, syncing it if required by the fsync policy.
+// On failure, any partially written record is truncated from the log.
+func (s *logStore) append(line []byte) error {
+	info, err := s.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.file.Write(line)
+	if err == nil && s.fsync == FsyncAlways {
+		err = s.file.Sync()
+	}
+
+	if err != nil {
+		s.file.Truncate(info.Size())
+		return err
+	}
+
+	if s.fsync != FsyncAlways {
+		s.dirty = true
+	}
+	return nil
+}
+
+func (s *logStore) write(r logRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return os.ErrClosed
+	}
+
+	if r.Op == opRemove && (r.Index < 0 || r.Index >= len(s.queues[r.Queue])) {
+		return fmt.Errorf("Cannot remove non-existent message %d from \"%s\"", r.Index, r.Queue)
+	}
+
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	if err := s.append(append(line, '\n')); err != nil {
+		return err
+	}
+
+	// The record is only applied once it has been durably written, such
+	// that the queues never reflect a record that the log may not contain.
+	s.records++
+	s.apply(r)
+
+	// The record has already been applied, so a failed compaction must not
+	// be reported as a failed write. Compaction is retried on a later write,
+	// and subsequent writes fail if the log could not be reopened.
+	if s.records >= compactThreshold && s.records > compactRatio*s.live() {
+		s.compact()
+	}
+
+	return nil
+}
+
+func (s *logStore) syncPeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.mutex.Lock()
+			if s.dirty && s.file != nil {
+				s.file.Sync()
+				s.dirty = false
+			}
+			s.mutex.Unlock()
+		}
+	}
+}
+
+func (s *logStore) Append(queue string, m network.Message) error {
+	return s.write(logRecord{Op: opAppend, Queue: queue, Msg: &m})
+}
+
+func (s *logStore) Remove(queue string, index int) error {
+	return s.write(logRecord{Op: opRemove, Queue: queue, Index: index})
+}
+
+func (s *logStore) Load() (map[string][]network.Message, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ret := map[string][]network.Message{}
+	for queue, msgs := range s.queues {
+		ret[queue] = append([]network.Message{}, msgs...)
+	}
+	return ret, nil
+}
+
+func (s *logStore) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	close(s.done)
+
+	err := s.file.Sync()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	s.file = nil
+	return err
+}
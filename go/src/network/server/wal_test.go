@@ -0,0 +1,227 @@
+// SPDX License Identifier: MIT
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jynik/skullsup/go/src/network"
+)
+
+func tempLog(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "skullsup-wal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "queues.log"), func() { os.RemoveAll(dir) }
+}
+
+func openLog(t *testing.T, path string) Store {
+	s, err := OpenLog(path, FsyncAlways, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func load(t *testing.T, s Store) map[string][]network.Message {
+	queues, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return queues
+}
+
+func msg(id uint64) network.Message {
+	return network.Message{ID: id, Command: network.CmdIncant, Args: []string{"pulse"}}
+}
+
+func countRecords(t *testing.T, path string) int {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Count(data, []byte{'\n'})
+}
+
+func TestLogReopen(t *testing.T) {
+	path, cleanup := tempLog(t)
+	defer cleanup()
+
+	s := openLog(t, path)
+	for _, op := range []func() error{
+		func() error { return s.Append("a", msg(1)) },
+		func() error { return s.Append("a", msg(2)) },
+		func() error { return s.Append("b", msg(3)) },
+		func() error { return s.Append("a", msg(4)) },
+		func() error { return s.Remove("a", 1) },
+		func() error { return s.Append("c", msg(5)) },
+		func() error { return s.Remove("c", 0) },
+	} {
+		if err := op(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := map[string][]network.Message{
+		"a": {msg(1), msg(4)},
+		"b": {msg(3)},
+	}
+
+	if got := load(t, s); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openLog(t, path)
+	defer s.Close()
+
+	if got := load(t, s); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v after reopening, got %v", want, got)
+	}
+
+	// Reopening compacts the log to one record per message
+	if n := countRecords(t, path); n != 3 {
+		t.Errorf("Expected 3 records after compaction, got %d", n)
+	}
+}
+
+func TestLogInvalidRemove(t *testing.T) {
+	path, cleanup := tempLog(t)
+	defer cleanup()
+
+	s := openLog(t, path)
+	defer s.Close()
+
+	if err := s.Append("a", msg(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		queue string
+		index int
+	}{{"a", 1}, {"a", -1}, {"b", 0}} {
+		if err := s.Remove(test.queue, test.index); err == nil {
+			t.Errorf("Expected an error removing %d from \"%s\"", test.index, test.queue)
+		}
+	}
+
+	if n := countRecords(t, path); n != 1 {
+		t.Errorf("Invalid removals were logged: %d records", n)
+	}
+}
+
+func TestLogCompact(t *testing.T) {
+	path, cleanup := tempLog(t)
+	defer cleanup()
+
+	s := openLog(t, path)
+	defer s.Close()
+
+	if err := s.Append("a", msg(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := uint64(1); i <= compactThreshold; i++ {
+		if err := s.Append("a", msg(i)); err != nil {
+			t.Fatal(err)
+		} else if err := s.Remove("a", 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := countRecords(t, path); n >= compactThreshold {
+		t.Errorf("Log was not compacted: %d records", n)
+	}
+
+	want := map[string][]network.Message{"a": {msg(0)}}
+	if got := load(t, s); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v after compaction, got %v", want, got)
+	}
+
+	if err := s.Append("a", msg(compactThreshold+1)); err != nil {
+		t.Fatalf("Failed to write after compaction: %s", err)
+	}
+}
+
+func TestLogTruncated(t *testing.T) {
+	path, cleanup := tempLog(t)
+	defer cleanup()
+
+	s := openLog(t, path)
+	for i := uint64(1); i <= 3; i++ {
+		if err := s.Append("a", msg(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+
+	// Cut the final record short, as a crash partway through a write would
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := os.Truncate(path, info.Size()-10); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openLog(t, path)
+	want := map[string][]network.Message{"a": {msg(1), msg(2)}}
+	if got := load(t, s); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	// Subsequent records must not be appended to the partial record
+	if err := s.Append("a", msg(4)); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	s = openLog(t, path)
+	defer s.Close()
+
+	want["a"] = append(want["a"], msg(4))
+	if got := load(t, s); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v after reopening, got %v", want, got)
+	}
+}
+
+func TestLogCorrupt(t *testing.T) {
+	path, cleanup := tempLog(t)
+	defer cleanup()
+
+	data := `{"op":"append","queue":"a","msg":{"id":1}}` + "\n" +
+		`{"op":"append","queue":` + "\n" +
+		`{"op":"append","queue":"a","msg":{"id":2}}` + "\n"
+
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if s, err := OpenLog(path, FsyncAlways, time.Second); err == nil {
+		s.Close()
+		t.Error("Expected a corrupt record to be reported")
+	}
+
+	for _, data := range []string{
+		`{"op":"remove","queue":"a","index":0}` + "\n",
+		`{"op":"bogus","queue":"a"}` + "\n",
+		`{"op":"append","queue":"a"}` + "\n",
+	} {
+		if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if s, err := OpenLog(path, FsyncAlways, time.Second); err == nil {
+			s.Close()
+			t.Errorf("Expected an error replaying: %s", data)
+		}
+	}
+}
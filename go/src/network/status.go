@@ -0,0 +1,35 @@
+// SPDX License Identifier: MIT
+package network
+
+// Read-only views of a queue, which follow the queue's name in its URL
+const (
+	// Summary of the queue's contents, as a QueueStatus
+	ViewStatus = "status"
+
+	// Pending messages, in the order they will be delivered
+	ViewPeek = "peek"
+)
+
+type QueueStatus struct {
+	Name  string `json:"name"`
+	Topic bool   `json:"topic,omitempty"`
+
+	// Access granted to the requesting user
+	Read  bool `json:"read,omitempty"`
+	Write bool `json:"write,omitempty"`
+
+	// Number of messages held by the queue, including those awaiting
+	// acknowledgement or scheduled for later delivery
+	Depth    int `json:"depth"`
+	MaxDepth int `json:"max_depth"`
+
+	InFlight  int `json:"in_flight"` // Delivered, but not yet acknowledged
+	Scheduled int `json:"scheduled"` // Not yet due for delivery
+
+	// Time, in seconds, since the oldest message was queued
+	OldestAge float64 `json:"oldest_age"`
+
+	// For topics, the status of each subscriber's inbox. The topic's own
+	// counts are the totals across all inboxes.
+	Subscribers []QueueStatus `json:"subscribers,omitempty"`
+}
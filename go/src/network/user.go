@@ -7,6 +7,8 @@ type User struct {
 
 	ReadQueues  []string `json:"read_queues"`  // Queues user is permitted to read
 	WriteQueues []string `json:"write_queues"` // Queues user is permitted to write
+
+	MaxPriority int `json:"max_priority"` // Highest priority of messages user may write
 }
 
 func (u *User) canAccess(target string, queues []string) bool {
@@ -26,4 +28,8 @@ func (u *User) CanWrite(target string) bool {
 	return u.canAccess(target, u.WriteQueues)
 }
 
+func (u *User) CanPrioritize(priority int) bool {
+	return priority <= u.MaxPriority
+}
+
 type UserList []User
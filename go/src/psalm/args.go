@@ -0,0 +1,229 @@
+// SPDX License Identifier: MIT
+package psalm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jynik/skullsup/go/src/color"
+)
+
+// Psalm argument types
+type ArgType int
+
+const (
+	ArgColor    ArgType = iota // Any color accepted by color.New()
+	ArgInt                     // Integer
+	ArgFloat                   // Floating point value
+	ArgEnum                    // One of a fixed set of choices
+	ArgDuration                // Duration, e.g., "1.5s". Integers are treated as ms.
+	ArgText                    // Arbitrary text
+)
+
+func (t ArgType) String() string {
+	switch t {
+	case ArgColor:
+		return "color"
+	case ArgInt:
+		return "int"
+	case ArgFloat:
+		return "float"
+	case ArgEnum:
+		return "enum"
+	case ArgDuration:
+		return "duration"
+	case ArgText:
+		return "text"
+	default:
+		return "unknown"
+	}
+}
+
+// Description of a positional psalm argument
+type Param struct {
+	Name string
+	Type ArgType
+	Help string
+
+	// Value used when the argument is not provided. Parameters without
+	// defaults are required, and must precede those with defaults.
+	Default string
+
+	// Inclusive range of ArgInt, ArgFloat and ArgDuration (in ms) values.
+	// The range is not enforced if Max <= Min.
+	Min, Max float64
+
+	// Valid ArgEnum values
+	Choices []string
+
+	// Recommended luma range for random ArgColor values. The full
+	// range is used if not specified.
+	Luma Range
+}
+
+func (p *Param) required() bool {
+	return p.Default == ""
+}
+
+func (p *Param) hasRange() bool {
+	return p.Max > p.Min
+}
+
+func (p *Param) checkRange(x float64, s string) error {
+	if p.hasRange() && (x < p.Min || x > p.Max) {
+		return fmt.Errorf("Invalid %s: %s is outside of the range [%g, %g]", p.Name, s, p.Min, p.Max)
+	}
+	return nil
+}
+
+// Parse an argument string according to the parameter's type
+func (p *Param) parse(s string) (interface{}, error) {
+	s = strings.TrimSpace(s)
+
+	switch p.Type {
+	case ArgColor:
+		c, err := color.New(s)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s: %s", p.Name, s)
+		}
+		return c, nil
+
+	case ArgInt:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s: \"%s\" is not an integer", p.Name, s)
+		}
+		return n, p.checkRange(float64(n), s)
+
+	case ArgFloat:
+		x, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s: \"%s\" is not a number", p.Name, s)
+		}
+		return x, p.checkRange(x, s)
+
+	case ArgEnum:
+		for _, choice := range p.Choices {
+			if strings.ToLower(s) == strings.ToLower(choice) {
+				return choice, nil
+			}
+		}
+		return nil, fmt.Errorf("Invalid %s: \"%s\" is not one of: %s", p.Name, s, strings.Join(p.Choices, ", "))
+
+	case ArgDuration:
+		var d time.Duration
+		if ms, err := strconv.Atoi(s); err == nil {
+			d = time.Duration(ms) * time.Millisecond
+		} else if d, err = time.ParseDuration(s); err != nil {
+			return nil, fmt.Errorf("Invalid %s: \"%s\" is not a duration", p.Name, s)
+		}
+		return d, p.checkRange(float64(d/time.Millisecond), s)
+
+	case ArgText:
+		return s, nil
+	}
+
+	return nil, fmt.Errorf("Parameter %s has an invalid type", p.Name)
+}
+
+// Human-readable summary of the parameter's constraints
+func (p *Param) Summary() string {
+	var ret string
+
+	switch {
+	case p.Type == ArgEnum:
+		ret = strings.Join(p.Choices, "|")
+	case p.Type == ArgDuration && p.hasRange():
+		ret = fmt.Sprintf("duration, %g-%g ms", p.Min, p.Max)
+	case p.hasRange():
+		ret = fmt.Sprintf("%s, %g-%g", p.Type, p.Min, p.Max)
+	default:
+		ret = p.Type.String()
+	}
+
+	if !p.required() {
+		ret += ", default: " + p.Default
+	}
+
+	return ret
+}
+
+// Validated psalm arguments, accessed by parameter name.
+//
+// The accessors panic if the named parameter does not exist or is not of the
+// requested type, as this indicates a mismatch between a psalm's
+// implementation and its parameter list.
+type Args struct {
+	raw    []string
+	names  map[string]int
+	values []interface{}
+}
+
+// Parse and validate arguments against a parameter list, filling in defaults
+func parseArgs(params []Param, raw []string) (Args, error) {
+	args := Args{raw: raw, names: map[string]int{}, values: make([]interface{}, len(params))}
+
+	if len(raw) > len(params) {
+		return Args{}, fmt.Errorf("Too many arguments. At most %d may be provided.", len(params))
+	}
+
+	for i := range params {
+		p := &params[i]
+		args.names[p.Name] = i
+
+		s := p.Default
+		if i < len(raw) {
+			s = raw[i]
+		} else if p.required() {
+			return Args{}, fmt.Errorf("Missing required argument: %s", p.Name)
+		}
+
+		v, err := p.parse(s)
+		if err != nil {
+			return Args{}, err
+		}
+		args.values[i] = v
+	}
+
+	return args, nil
+}
+
+func (a Args) value(name string) interface{} {
+	i, ok := a.names[name]
+	if !ok {
+		panic("No such psalm parameter: " + name)
+	}
+	return a.values[i]
+}
+
+// The arguments as originally provided, prior to validation
+func (a Args) Raw() []string {
+	return a.raw
+}
+
+func (a Args) Color(name string) color.Color {
+	return a.value(name).(color.Color)
+}
+
+func (a Args) Int(name string) int {
+	return a.value(name).(int)
+}
+
+func (a Args) Float(name string) float64 {
+	return a.value(name).(float64)
+}
+
+// Returns the value of an ArgEnum argument, as listed in Param.Choices
+func (a Args) Enum(name string) string {
+	return a.value(name).(string)
+}
+
+func (a Args) Duration(name string) time.Duration {
+	return a.value(name).(time.Duration)
+}
+
+func (a Args) Text(name string) string {
+	return a.value(name).(string)
+}
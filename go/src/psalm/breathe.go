@@ -0,0 +1,30 @@
+// SPDX License Identifier: MIT
+package psalm
+
+import (
+	"math"
+
+	"github.com/jynik/skullsup/go/src/frame"
+)
+
+func breathe(args Args, dev Device) ([]frame.Frame, uint16, error) {
+	var frames []frame.Frame
+
+	c := args.Color("color")
+	floor := args.Float("floor")
+
+	steps := dev.frameLimit()
+	if steps > 32 {
+		steps = 32
+	}
+
+	for s := uint(0); s < steps; s++ {
+		// Ease in and out of each breath. Squaring the level better
+		// matches perceived brightness.
+		level := (1 - math.Cos(2*math.Pi*float64(s)/float64(steps))) / 2
+		level = floor + (1-floor)*level*level
+		frames = append(frames, frame.NewColor(brightness(c, level)))
+	}
+
+	return frames, 80, nil
+}
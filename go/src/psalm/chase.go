@@ -0,0 +1,30 @@
+// SPDX License Identifier: MIT
+package psalm
+
+import "github.com/jynik/skullsup/go/src/frame"
+
+func chase(args Args, dev Device) ([]frame.Frame, uint16, error) {
+	var frames []frame.Frame
+
+	fg := args.Color("foreground")
+	bg := args.Color("background")
+	spacing := uint(args.Int("spacing"))
+
+	// Every spacing-th LED along each strip is lit, marching forward
+	for s := uint(0); s < spacing; s++ {
+		frames = append(frames, frame.Frame{Led: frame.ALL_LEDS, Color: bg, Delay: false})
+
+		for i := uint(0); i < dev.LedCount; i++ {
+			if dev.position(i)%spacing == s {
+				frames = append(frames, frame.Frame{Led: uint8(i), Color: fg})
+			}
+		}
+		frames[len(frames)-1].Delay = true
+	}
+
+	if err := dev.checkFrames("chase", len(frames)); err != nil {
+		return nil, 0, err
+	}
+
+	return frames, 120, nil
+}
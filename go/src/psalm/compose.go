@@ -0,0 +1,497 @@
+// SPDX License Identifier: MIT
+package psalm
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/jynik/skullsup/go/src/color"
+	"github.com/jynik/skullsup/go/src/frame"
+)
+
+// Composite psalm operators, which may not be used as psalm names
+const (
+	SeqName     = "seq"     // seq(a, b, ...): Play each psalm in turn
+	OverlayName = "overlay" // overlay(a, b, ...): Additively blend psalms
+	RepeatName  = "repeat"  // repeat(n, a[, degrees]): Play a psalm n times, rotating its hue
+)
+
+// A single step of an animation, during which the LEDs are displayed
+type step struct {
+	leds    []color.Color
+	periods uint // Number of frame periods the step is held for
+}
+
+type timeline []step
+
+// Number of frame periods required to play the timeline
+func (t timeline) duration() uint {
+	var n uint
+	for _, s := range t {
+		n += s.periods
+	}
+	return n
+}
+
+// Returns the step displayed at the specified frame period, looping the timeline
+func (t timeline) at(n uint) step {
+	n %= t.duration()
+	for _, s := range t {
+		if n < s.periods {
+			return s
+		}
+		n -= s.periods
+	}
+	return t[len(t)-1]
+}
+
+// Node of a parsed composite expression
+type composite interface {
+	// Minimum number of steps in the animation, which is known without
+	// rendering it
+	length() uint
+
+	// Render the animation. The period is set to that of the first psalm
+	// rendered, if it is 0.
+	render(dev Device, period *uint16) (timeline, error)
+}
+
+// A single psalm and its arguments
+type invocation struct {
+	psalm *Psalm
+	args  []string
+}
+
+type seqNode []composite
+
+type overlayNode []composite
+
+type repeatNode struct {
+	count   int
+	degrees float64
+	child   composite
+}
+
+func (n *invocation) length() uint {
+	return 1
+}
+
+// Play the psalm's animation until it reaches a steady state, as a looping
+// animation's trailing frames carry over into its next pass, and record
+// each subsequent step. LEDs are initially off.
+func (n *invocation) render(dev Device, period *uint16) (timeline, error) {
+	var ret timeline
+
+	frames, defaultPeriod, err := n.psalm.Generate(n.args, 0, dev)
+	if err != nil {
+		return nil, err
+	}
+
+	if *period == 0 {
+		*period = defaultPeriod
+	}
+
+	leds := make([]color.Color, dev.LedCount)
+	apply := func(f frame.Frame) {
+		if f.Led == frame.ALL_LEDS {
+			for i := range leds {
+				leds[i] = f.Color
+			}
+		} else if uint(f.Led) < dev.LedCount {
+			leds[f.Led] = f.Color
+		}
+	}
+
+	for _, f := range frames {
+		apply(f)
+	}
+
+	for _, f := range frames {
+		apply(f)
+		if f.Delay {
+			periods := uint(1)
+			if f.Duration > 1 {
+				periods = uint(f.Duration)
+			}
+			ret = append(ret, step{append([]color.Color{}, leds...), periods})
+		}
+	}
+
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("%s has no delayed frames", n.psalm.Name)
+	}
+
+	return ret, nil
+}
+
+func (n seqNode) length() uint {
+	var ret uint
+	for _, child := range n {
+		ret += child.length()
+	}
+	return ret
+}
+
+func (n seqNode) render(dev Device, period *uint16) (timeline, error) {
+	var ret timeline
+	for _, child := range n {
+		t, err := child.render(dev, period)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, t...)
+	}
+	return ret, nil
+}
+
+func (n overlayNode) length() uint {
+	var ret uint
+	for _, child := range n {
+		if l := child.length(); l > ret {
+			ret = l
+		}
+	}
+	return ret
+}
+
+// Blend the psalms' LEDs at each point in time at which any of them change.
+// Shorter animations are looped to fill the duration of the longest.
+func (n overlayNode) render(dev Device, period *uint16) (timeline, error) {
+	var ret timeline
+	var layers []timeline
+	var length uint
+
+	for _, child := range n {
+		t, err := child.render(dev, period)
+		if err != nil {
+			return nil, err
+		}
+
+		layers = append(layers, t)
+		if d := t.duration(); d > length {
+			length = d
+		}
+	}
+
+	// Step boundaries within the longest layer
+	boundaries := map[uint]bool{length: true}
+	for _, t := range layers {
+		for start := uint(0); start < length; start += t.duration() {
+			n := start
+			for _, s := range t {
+				boundaries[n] = true
+				n += s.periods
+			}
+		}
+	}
+
+	for n := uint(0); n < length; {
+		next := length
+		for b := range boundaries {
+			if b > n && b < next {
+				next = b
+			}
+		}
+
+		s := step{make([]color.Color, dev.LedCount), next - n}
+		for _, t := range layers {
+			for i, c := range t.at(n).leds {
+				s.leds[i] = s.leds[i].Add(c)
+			}
+		}
+
+		ret = append(ret, s)
+		n = next
+	}
+
+	return ret, nil
+}
+
+func (n *repeatNode) length() uint {
+	return uint(n.count) * n.child.length()
+}
+
+func (n *repeatNode) render(dev Device, period *uint16) (timeline, error) {
+	var ret timeline
+
+	t, err := n.child.render(dev, period)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each step requires at least one frame, so reject repetitions that
+	// cannot fit before rendering them
+	if err := dev.checkFrames("Composition", n.count*len(t)); err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < n.count; i++ {
+		for _, s := range t {
+			leds := make([]color.Color, len(s.leds))
+			for j, c := range s.leds {
+				leds[j] = c.RotateHue(n.degrees * float64(i))
+			}
+			ret = append(ret, step{leds, s.periods})
+		}
+	}
+
+	return ret, nil
+}
+
+// Returns true if the expression begins with a composite operator
+func isComposite(expr string) bool {
+	expr = strings.ToLower(strings.TrimSpace(expr))
+	for _, op := range []string{SeqName, OverlayName, RepeatName} {
+		if strings.HasPrefix(expr, op) && strings.HasPrefix(strings.TrimSpace(expr[len(op):]), "(") {
+			return true
+		}
+	}
+	return false
+}
+
+// Parser for composite expressions
+type composer struct {
+	s   string
+	pos int
+}
+
+func (c *composer) skipSpace() {
+	for c.pos < len(c.s) && strings.ContainsRune(" \t\n", rune(c.s[c.pos])) {
+		c.pos++
+	}
+}
+
+func (c *composer) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("Invalid composition at column %d: %s", c.pos+1, fmt.Sprintf(format, args...))
+}
+
+// Read text up to a comma or closing parenthesis at the current depth
+func (c *composer) term() string {
+	depth := 0
+	start := c.pos
+
+	for ; c.pos < len(c.s); c.pos++ {
+		switch c.s[c.pos] {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return c.s[start:c.pos]
+			}
+			depth--
+		case ',':
+			if depth == 0 {
+				return c.s[start:c.pos]
+			}
+		}
+	}
+
+	return c.s[start:]
+}
+
+// Parse a comma-separated list of expressions, through the closing parenthesis
+func (c *composer) list() ([]composite, error) {
+	var ret []composite
+
+	for {
+		n, err := c.expr()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, n)
+
+		c.skipSpace()
+		if c.pos >= len(c.s) {
+			return nil, c.errorf("Expected ')'")
+		}
+
+		c.pos++
+		if c.s[c.pos-1] == ')' {
+			return ret, nil
+		}
+	}
+}
+
+func (c *composer) expr() (composite, error) {
+	c.skipSpace()
+
+	start := c.pos
+	for c.pos < len(c.s) && !strings.ContainsRune(" \t\n(),", rune(c.s[c.pos])) {
+		c.pos++
+	}
+	name := strings.ToLower(c.s[start:c.pos])
+
+	c.skipSpace()
+	if c.pos < len(c.s) && c.s[c.pos] == '(' {
+		c.pos++
+
+		switch name {
+		case SeqName:
+			children, err := c.list()
+			return seqNode(children), err
+		case OverlayName:
+			children, err := c.list()
+			return overlayNode(children), err
+		case RepeatName:
+			return c.repeat()
+		default:
+			return nil, c.errorf("Unknown operator: %s", name)
+		}
+	}
+
+	p := Find(name)
+	if p == nil {
+		return nil, c.errorf("No such psalm: %s", name)
+	} else if p.Split {
+		// Compositions are uploaded as a single animation, so psalms that
+		// must be split across uploads cannot be part of one
+		return nil, c.errorf("%s cannot be used in compositions", p.Name)
+	}
+
+	return &invocation{p, splitArgs(c.term())}, nil
+}
+
+// Split psalm arguments on whitespace outside of parentheses, such that
+// colors like "rgb(1, 2, 3)" are kept intact
+func splitArgs(s string) []string {
+	var ret []string
+	depth := 0
+	start := -1
+
+	for i, r := range s {
+		switch {
+		case r == '(':
+			depth++
+		case r == ')' && depth > 0:
+			depth--
+		case strings.ContainsRune(" \t\n", r) && depth == 0:
+			if start >= 0 {
+				ret = append(ret, s[start:i])
+				start = -1
+			}
+			continue
+		}
+
+		if start < 0 {
+			start = i
+		}
+	}
+
+	if start >= 0 {
+		ret = append(ret, s[start:])
+	}
+
+	return ret
+}
+
+// Parse a number, followed by a comma or closing parenthesis
+func (c *composer) number(what string) (float64, byte, error) {
+	s := strings.TrimSpace(c.term())
+	x, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, 0, c.errorf("Invalid %s: %s", what, s)
+	} else if c.pos >= len(c.s) {
+		return 0, 0, c.errorf("Expected ')'")
+	}
+
+	c.pos++
+	return x, c.s[c.pos-1], nil
+}
+
+// Parse the arguments of repeat(count, psalm[, degrees])
+func (c *composer) repeat() (composite, error) {
+	count, sep, err := c.number("count")
+	if err != nil {
+		return nil, err
+	} else if sep != ',' || count < 1 || count != math.Trunc(count) {
+		return nil, c.errorf("Expected repeat(count, psalm[, degrees])")
+	} else if count > maxFrameLimit {
+		return nil, c.errorf("Repeat count of %.0f exceeds the maximum of %d", count, maxFrameLimit)
+	}
+
+	child, err := c.expr()
+	if err != nil {
+		return nil, err
+	}
+
+	if l := uint(count) * child.length(); l > maxFrameLimit {
+		return nil, c.errorf("Repetition requires at least %d frames, but devices support at most %d", l, maxFrameLimit)
+	}
+
+	n := &repeatNode{count: int(count), child: child}
+
+	c.skipSpace()
+	if c.pos >= len(c.s) {
+		return nil, c.errorf("Expected ')'")
+	}
+
+	c.pos++
+	switch c.s[c.pos-1] {
+	case ')':
+		return n, nil
+	case ',':
+		if n.degrees, sep, err = c.number("degrees"); err != nil {
+			return nil, err
+		} else if sep == ')' {
+			return n, nil
+		}
+	}
+
+	return nil, c.errorf("Expected repeat(count, psalm[, degrees])")
+}
+
+// Parse a composite expression
+func compose(s string) (composite, error) {
+	c := &composer{s: s}
+
+	n, err := c.expr()
+	if err != nil {
+		return nil, err
+	}
+
+	c.skipSpace()
+	if c.pos != len(c.s) {
+		return nil, c.errorf("Unexpected '%c'", c.s[c.pos])
+	}
+
+	return n, nil
+}
+
+// Convert a timeline into frames
+func (t timeline) frames() []frame.Frame {
+	var frames []frame.Frame
+
+	for _, s := range t {
+		for i, c := range s.leds {
+			frames = append(frames, frame.Frame{Led: uint8(i), Color: c})
+		}
+
+		last := &frames[len(frames)-1]
+		last.Delay = true
+		last.Duration = uint8(s.periods)
+	}
+
+	return frames
+}
+
+// Generate the frames for a composite expression
+func lookupComposite(expr string, period uint16, dev Device) ([]frame.Frame, uint16, error) {
+	n, err := compose(expr)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	t, err := n.render(dev, &period)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	frames := frame.Optimize(t.frames(), dev.LedCount)
+	if err := dev.checkFrames("Composition", len(frame.Expand(frames))); err != nil {
+		return nil, 0, err
+	}
+
+	return frames, period, nil
+}
@@ -0,0 +1,122 @@
+// SPDX License Identifier: MIT
+package psalm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jynik/skullsup/go/src/frame"
+)
+
+// Split an expression as the command line does, and look it up
+func lookupExpr(expr string, dev Device) ([]frame.Frame, uint16, error) {
+	words := strings.Fields(expr)
+	return Lookup(words[0], words[1:], 0, dev)
+}
+
+func validateExpr(expr string) error {
+	words := strings.Fields(expr)
+	return Validate(words[0], words[1:], 0)
+}
+
+func TestComposeLength(t *testing.T) {
+	tests := []struct {
+		expr   string
+		frames int // Expected number of expanded frames, or 0 if it does not fit
+	}{
+		{"seq(pulse red, vortex lime black)", 55},
+		{"seq(pulse red)", 23},
+		{"overlay(pulse red, vortex lime black)", 0},
+		{"repeat(2, seq(pulse, vortex))", 0},
+		{"repeat(3, repeat(2, pulse))", 0},
+		{"repeat(2, seq(pulse red, vortex lime black))", 0},
+	}
+
+	for _, test := range tests {
+		frames, _, err := lookupExpr(test.expr, defaultDevice)
+		if n := len(frame.Expand(frames)); test.frames != 0 && (err != nil || n != test.frames) {
+			t.Errorf("%s: expected %d frames, got %d (%v)", test.expr, test.frames, n, err)
+		}
+
+		// Compositions that are accepted by the writer must be accepted by
+		// the reader, and vice versa
+		if verr := validateExpr(test.expr); (verr == nil) != (err == nil) {
+			t.Errorf("%s: validation (%v) and lookup (%v) disagree", test.expr, verr, err)
+		}
+	}
+}
+
+func TestComposeErrors(t *testing.T) {
+	for _, expr := range []string{
+		"seq(pulse red",
+		"seq(pulse red))",
+		"seq(nonexistent)",
+		"bogus(pulse)",
+		"repeat(0, pulse)",
+		"repeat(1.5, pulse)",
+		"repeat(256, pulse)",
+		"repeat(200, repeat(2, pulse))",
+		"repeat(2, pulse, x)",
+		"repeat(pulse)",
+		"seq(morse hi)",
+		"repeat(2, morse)",
+	} {
+		if _, err := compose(expr); err == nil {
+			t.Errorf("%s: expected a parse error", expr)
+		}
+
+		if err := validateExpr(expr); err == nil {
+			t.Errorf("%s: expected a validation error", expr)
+		}
+	}
+
+	// Arguments are validated when the composition is rendered
+	for _, expr := range []string{
+		"seq(pulse notacolor)",
+		"seq(pulse red, vortex lime black extra)",
+	} {
+		if err := validateExpr(expr); err == nil {
+			t.Errorf("%s: expected a validation error", expr)
+		}
+	}
+}
+
+func TestComposeArgs(t *testing.T) {
+	n, err := compose("seq(pulse rgb(255, 0, 0), vortex hsv(120, 1, 1)  black)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := [][]string{n.(seqNode)[0].(*invocation).args, n.(seqNode)[1].(*invocation).args}
+	want := [][]string{{"rgb(255, 0, 0)"}, {"hsv(120, 1, 1)", "black"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected arguments %q, got %q", want, got)
+	}
+
+	frames, _, err := lookupExpr("seq(pulse rgb(255, 0, 0), vortex lime black)", defaultDevice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	named, _, err := lookupExpr("seq(pulse red, vortex lime black)", defaultDevice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(frames, named) {
+		t.Error("rgb() and named colors produced different frames")
+	}
+}
+
+func TestComposePeriod(t *testing.T) {
+	_, period, err := lookupExpr("seq(vortex, pulse)", defaultDevice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, want, _ := Lookup("vortex", nil, 0, defaultDevice)
+	if period != want {
+		t.Errorf("Expected the first psalm's period of %d ms, got %d", want, period)
+	}
+}
@@ -0,0 +1,46 @@
+// SPDX License Identifier: MIT
+package psalm
+
+import (
+	"math/rand"
+
+	"github.com/jynik/skullsup/go/src/frame"
+)
+
+func fire(args Args, dev Device) ([]frame.Frame, uint16, error) {
+	var frames []frame.Frame
+
+	c := args.Color("color")
+	flicker := args.Float("flicker")
+
+	// A fixed seed yields the same flames each time the psalm is incanted
+	rng := rand.New(rand.NewSource(666))
+
+	// Kindle every LED, and then flicker a quarter of them at each step
+	frames = append(frames, frame.Frame{Led: frame.ALL_LEDS, Color: c, Delay: false})
+
+	perStep := dev.LedCount / 4
+	if perStep < 1 {
+		perStep = 1
+	}
+
+	steps := (dev.frameLimit() - 1) / perStep
+	if steps > 24 {
+		steps = 24
+	}
+
+	for s := uint(0); s < steps; s++ {
+		for k := uint(0); k < perStep; k++ {
+			led := uint8(rng.Intn(int(dev.LedCount)))
+
+			// Dimmer embers also burn redder
+			dim := flicker * rng.Float64()
+			ember := brightness(c.RotateHue(-20*dim), 1-dim)
+
+			frames = append(frames, frame.Frame{Led: led, Color: ember})
+		}
+		frames[len(frames)-1].Delay = true
+	}
+
+	return frames, 70, nil
+}
@@ -0,0 +1,63 @@
+// SPDX License Identifier: MIT
+package psalm
+
+import (
+	"math"
+
+	"github.com/jynik/skullsup/go/src/frame"
+)
+
+// Name of the color parameter to use for a value, according to the thresholds.
+// If the warning threshold exceeds the critical threshold, lower values are
+// considered worse.
+func gaugeColor(args Args, value float64) string {
+	warn, crit := args.Float("warn"), args.Float("critical")
+
+	if warn > crit {
+		value, warn, crit = -value, -warn, -crit
+	}
+
+	switch {
+	case value >= crit:
+		return "danger"
+	case value >= warn:
+		return "caution"
+	default:
+		return "good"
+	}
+}
+
+func gauge(args Args, dev Device) ([]frame.Frame, uint16, error) {
+	var frames []frame.Frame
+
+	value := args.Float("value")
+	fg := args.Color(gaugeColor(args, value))
+	bg := args.Color("background")
+
+	// Each strip is filled from its base, with the last lit LED dimmed in
+	// proportion to any remainder. Without a known layout, the LEDs are
+	// assumed to form two strips running in opposite directions, as is
+	// the case for the hellivator.
+	layout := dev.Layout
+	if !dev.layoutKnown() {
+		layout = frame.Layout{NumStrips: 2, StripLen: dev.LedCount / 2, Flags: frame.LAYOUT_WRAP_INVERT}
+	}
+
+	level := value / 100 * float64(layout.StripLen)
+	full := uint(level)
+	partial := level - math.Floor(level)
+
+	frames = append(frames, frame.Frame{Led: frame.ALL_LEDS, Color: bg, Delay: false})
+
+	for i := uint(0); i < dev.LedCount; i++ {
+		pos := layout.Position(i)
+		if pos < full {
+			frames = append(frames, frame.Frame{Led: uint8(i), Color: fg})
+		} else if pos == full && partial > 0 {
+			frames = append(frames, frame.Frame{Led: uint8(i), Color: bg.LerpGamma(fg, partial)})
+		}
+	}
+
+	frames[len(frames)-1].Delay = true
+	return frames, 1000, nil
+}
@@ -0,0 +1,82 @@
+// SPDX License Identifier: MIT
+package psalm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/jynik/skullsup/go/src/frame"
+)
+
+// International Morse code
+var morseCode = map[rune]string{
+	'a': ".-", 'b': "-...", 'c': "-.-.", 'd': "-..", 'e': ".", 'f': "..-.",
+	'g': "--.", 'h': "....", 'i': "..", 'j': ".---", 'k': "-.-", 'l': ".-..",
+	'm': "--", 'n': "-.", 'o': "---", 'p': ".--.", 'q': "--.-", 'r': ".-.",
+	's': "...", 't': "-", 'u': "..-", 'v': "...-", 'w': ".--", 'x': "-..-",
+	'y': "-.--", 'z': "--..",
+
+	'0': "-----", '1': ".----", '2': "..---", '3': "...--", '4': "....-",
+	'5': ".....", '6': "-....", '7': "--...", '8': "---..", '9': "----.",
+
+	'.': ".-.-.-", ',': "--..--", '?': "..--..", '\'': ".----.", '!': "-.-.--",
+	'/': "-..-.", '(': "-.--.", ')': "-.--.-", '&': ".-...", ':': "---...",
+	';': "-.-.-.", '=': "-...-", '+': ".-.-.", '-': "-....-", '_': "..--.-",
+	'"': ".-..-.", '$': "...-..-", '@': ".--.-.",
+}
+
+// Morse code timing, in units of the frame period
+const (
+	morseDot       = 1
+	morseDash      = 3
+	morseSymbolGap = 1 // Between the dots and dashes of a character
+	morseLetterGap = 3
+	morseWordGap   = 7
+)
+
+// Messages longer than the device's frame buffer are split across multiple
+// uploads by the device, via Psalm.Split.
+func morse(args Args, dev Device) ([]frame.Frame, uint16, error) {
+	var frames []frame.Frame
+
+	fg := args.Color("foreground")
+	bg := args.Color("background")
+
+	// Lengthen the gap following the most recent symbol
+	gap := func(units uint8) {
+		if f := &frames[len(frames)-1]; f.Duration < units {
+			f.Duration = units
+		}
+	}
+
+	for _, word := range strings.Fields(strings.ToLower(args.Text("text"))) {
+		for _, r := range word {
+			code, ok := morseCode[r]
+			if !ok {
+				return nil, 0, fmt.Errorf("There is no Morse code for '%c'", unicode.ToUpper(r))
+			}
+
+			for _, symbol := range code {
+				duration := uint8(morseDot)
+				if symbol == '-' {
+					duration = morseDash
+				}
+
+				frames = append(frames, frame.Frame{Led: frame.ALL_LEDS, Color: fg, Delay: true, Duration: duration})
+				frames = append(frames, frame.Frame{Led: frame.ALL_LEDS, Color: bg, Delay: true, Duration: morseSymbolGap})
+			}
+
+			gap(morseLetterGap)
+		}
+
+		gap(morseWordGap)
+	}
+
+	if len(frames) == 0 {
+		return nil, 0, errors.New("morse requires text to signal")
+	}
+
+	return frames, 150, nil
+}
@@ -3,60 +3,382 @@ package psalm
 
 import (
 	"errors"
+	"fmt"
 	"strings"
 
 	"github.com/jynik/skullsup/go/src/frame"
 )
 
+// Attributes of the device upon which a psalm is incanted
+type Device struct {
+	LedCount  uint         // Total number of LEDs
+	Layout    frame.Layout // Physical arrangement of the LEDs
+	MaxFrames uint         // Maximum number of frames the device can store
+}
+
+// Generates the frames that comprise a psalm's animation, given its validated
+// arguments. Returns the frames and the psalm's default period, in ms.
+type Generator interface {
+	Generate(args Args, dev Device) ([]frame.Frame, uint16, error)
+}
+
+// Allows an ordinary function to be used as a Generator
+type GeneratorFunc func(args Args, dev Device) ([]frame.Frame, uint16, error)
+
+func (f GeneratorFunc) Generate(args Args, dev Device) ([]frame.Frame, uint16, error) {
+	return f(args, dev)
+}
+
 type Psalm struct {
-	Name     string
-	Args     Range
-	ArgNames []string
-	Period   Range
-	Luma     []Range // Luma range per argument
-	impl     func([]string, uint) ([]frame.Frame, uint16, error)
+	Name        string
+	Description string
+	Author      string
+	MinLeds     uint    // Minimum number of LEDs required by the animation
+	Params      []Param // Positional arguments
+	Period      Range   // Supported frame period range, in ms
+	Generator   Generator
+
+	// The animation may exceed the device's frame buffer, in which case it
+	// is uploaded in segments that are each played once, rather than looped.
+	Split bool
 }
 
+// Name reserved for choosing a random psalm
+const RandomName = "random"
+
+// Registered psalms. Use Register() to add to this list.
 var List []Psalm = []Psalm{
 	{
-		Name:     "hellivator",
-		Args:     Range{0, 2},
-		ArgNames: []string{"foreground", "background"},
-		Period:   Range{65, 150},
-		Luma:     []Range{{128, 255}, {0, 32}},
-		impl:     hellivator,
+		Name:        "breathe",
+		Description: "The slow breath of something that should not live.",
+		MinLeds:     1,
+		Params: []Param{
+			{Name: "color", Type: ArgColor, Default: "teal", Luma: Range{48, 255}},
+			{Name: "floor", Type: ArgFloat, Default: "0.05", Min: 0, Max: 0.5,
+				Help: "Brightness between breaths"},
+		},
+		Period:    Range{30, 200},
+		Generator: GeneratorFunc(breathe),
+	},
+
+	{
+		Name:        "chase",
+		Description: "Lost souls marching endlessly onward.",
+		MinLeds:     2,
+		Params: []Param{
+			{Name: "foreground", Type: ArgColor, Default: "orange", Luma: Range{96, 255}},
+			{Name: "background", Type: ArgColor, Default: "000000", Luma: Range{0, 24}},
+			{Name: "spacing", Type: ArgInt, Default: "3", Min: 2, Max: 8,
+				Help: "Distance between lit LEDs"},
+		},
+		Period:    Range{50, 300},
+		Generator: GeneratorFunc(chase),
+	},
+
+	{
+		Name:        "fire",
+		Description: "The flickering flames of the Pit.",
+		MinLeds:     1,
+		Params: []Param{
+			{Name: "color", Type: ArgColor, Default: "ff5000", Luma: Range{96, 255}},
+			{Name: "flicker", Type: ArgFloat, Default: "0.6", Min: 0, Max: 1,
+				Help: "How much the flames dim as they flicker"},
+		},
+		Period:    Range{40, 150},
+		Generator: GeneratorFunc(fire),
 	},
 
 	{
-		Name:     "pulse",
-		Args:     Range{0, 1},
-		ArgNames: []string{"color"},
-		Period:   Range{50, 85},
-		Luma:     []Range{{32, 255}},
-		impl:     pulse,
+		Name:        "gauge",
+		Description: "Measure how close the end draws, from 0 to 100.",
+		MinLeds:     1,
+		Params: []Param{
+			{Name: "value", Type: ArgFloat, Min: 0, Max: 100},
+			{Name: "warn", Type: ArgFloat, Default: "60", Min: 0, Max: 100,
+				Help: "Warning threshold. Lower values are worse if this exceeds critical."},
+			{Name: "critical", Type: ArgFloat, Default: "85", Min: 0, Max: 100,
+				Help: "Critical threshold"},
+			{Name: "good", Type: ArgColor, Default: "00ff00", Luma: Range{64, 255}},
+			{Name: "caution", Type: ArgColor, Default: "ffa000", Luma: Range{64, 255}},
+			{Name: "danger", Type: ArgColor, Default: "ff0000", Luma: Range{64, 255}},
+			{Name: "background", Type: ArgColor, Default: "000000", Luma: Range{0, 16}},
+		},
+		Generator: GeneratorFunc(gauge),
 	},
 
 	{
-		Name:     "vortex",
-		Args:     Range{0, 2},
-		ArgNames: []string{"foreground", "background"},
-		Period:   Range{65, 125},
-		Luma:     []Range{{64, 255}, {0, 64}},
-		impl:     vortex,
+		Name:        "hellivator",
+		Description: "Rise from the depths, then descend back into them.",
+		MinLeds:     4,
+		Params: []Param{
+			{Name: "foreground", Type: ArgColor, Default: "008000", Luma: Range{128, 255}},
+			{Name: "background", Type: ArgColor, Default: "000030", Luma: Range{0, 32}},
+		},
+		Period:    Range{65, 150},
+		Generator: GeneratorFunc(hellivator),
+	},
+
+	{
+		Name:        "morse",
+		Description: "Tap out a message from beyond the grave.",
+		MinLeds:     1,
+		Params: []Param{
+			{Name: "text", Type: ArgText, Default: "SOS"},
+			{Name: "foreground", Type: ArgColor, Default: "ff0000", Luma: Range{96, 255}},
+			{Name: "background", Type: ArgColor, Default: "000000", Luma: Range{0, 16}},
+		},
+		Period:    Range{50, 400},
+		Generator: GeneratorFunc(morse),
+		Split:     true,
+	},
+
+	{
+		Name:        "pulse",
+		Description: "The beating of a hideous heart.",
+		MinLeds:     1,
+		Params: []Param{
+			{Name: "color", Type: ArgColor, Default: "ff0000", Luma: Range{32, 255}},
+		},
+		Period:    Range{50, 85},
+		Generator: GeneratorFunc(pulse),
+	},
+
+	{
+		Name:        "rainbow",
+		Description: "Every hue of a dying world.",
+		MinLeds:     1,
+		Params: []Param{
+			{Name: "mode", Type: ArgEnum, Default: "cycle", Choices: []string{"cycle", "wheel"},
+				Help: "Cycle all LEDs in unison, or spread hues along each strip"},
+			{Name: "saturation", Type: ArgFloat, Default: "1", Min: 0.25, Max: 1},
+			{Name: "brightness", Type: ArgFloat, Default: "0.5", Min: 0.1, Max: 1},
+		},
+		Period:    Range{30, 1000},
+		Generator: GeneratorFunc(rainbow),
+	},
+
+	{
+		Name:        "sparkle",
+		Description: "Eyes glinting in the dark.",
+		MinLeds:     1,
+		Params: []Param{
+			{Name: "foreground", Type: ArgColor, Default: "ffffff", Luma: Range{160, 255}},
+			{Name: "background", Type: ArgColor, Default: "000010", Luma: Range{0, 24}},
+			{Name: "density", Type: ArgInt, Default: "2", Min: 1, Max: 8,
+				Help: "Number of LEDs that sparkle at once"},
+		},
+		Period:    Range{40, 250},
+		Generator: GeneratorFunc(sparkle),
+	},
+
+	{
+		Name:        "strobe",
+		Description: "Lightning over the graveyard.",
+		MinLeds:     1,
+		Params: []Param{
+			{Name: "color", Type: ArgColor, Default: "ffffff", Luma: Range{192, 255}},
+			{Name: "flashes", Type: ArgInt, Default: "2", Min: 1, Max: 10,
+				Help: "Number of flashes in each burst"},
+			{Name: "rest", Type: ArgInt, Default: "8", Min: 0, Max: 30,
+				Help: "Frame periods of darkness between bursts"},
+		},
+		Period:    Range{20, 100},
+		Generator: GeneratorFunc(strobe),
+	},
+
+	{
+		Name:        "vortex",
+		Description: "A single light circling the abyss.",
+		MinLeds:     1,
+		Params: []Param{
+			{Name: "foreground", Type: ArgColor, Default: "ff0000", Luma: Range{64, 255}},
+			{Name: "background", Type: ArgColor, Default: "000505", Luma: Range{0, 64}},
+		},
+		Period:    Range{65, 125},
+		Generator: GeneratorFunc(vortex),
 	},
 }
 
-func Lookup(name string, args []string, ledCount uint) ([]frame.Frame, uint16, error) {
-	if ledCount < 1 || ledCount&0x1 != 0 {
-		return []frame.Frame{}, 0, errors.New("Invalid LED count")
+// Find a registered psalm by name. Returns nil if no such psalm exists.
+func Find(name string) *Psalm {
+	name = strings.ToLower(name)
+	for i := range List {
+		if name == List[i].Name {
+			return &List[i]
+		}
 	}
+	return nil
+}
+
+func (p *Psalm) validateParams() error {
+	names := map[string]bool{}
+	optional := false
+
+	for i := range p.Params {
+		param := &p.Params[i]
 
-	nameLower := strings.ToLower(name)
-	for _, psalm := range List {
-		if nameLower == psalm.Name {
-			return psalm.impl(args, ledCount)
+		if param.Name == "" {
+			return fmt.Errorf("Psalm \"%s\" has an unnamed parameter", p.Name)
+		} else if names[param.Name] {
+			return fmt.Errorf("Psalm \"%s\" has duplicate parameter: %s", p.Name, param.Name)
+		} else if param.Type == ArgEnum && len(param.Choices) == 0 {
+			return fmt.Errorf("Psalm \"%s\" parameter %s has no choices", p.Name, param.Name)
+		} else if param.required() && optional {
+			return fmt.Errorf("Psalm \"%s\" parameter %s is required, but follows an optional parameter", p.Name, param.Name)
 		}
+		names[param.Name] = true
+		optional = !param.required()
+
+		if !param.required() {
+			if _, err := param.parse(param.Default); err != nil {
+				return fmt.Errorf("Psalm \"%s\" has an invalid default: %s", p.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Register a psalm, making it available to Lookup() and Random().
+//
+// Psalm names are case-insensitive and must be unique. This is intended
+// to be called from an init() function, and is not safe to call
+// concurrently with other functions in this package.
+func Register(p Psalm) error {
+	p.Name = strings.ToLower(strings.TrimSpace(p.Name))
+
+	if err := p.Verify(); err != nil {
+		return err
+	} else if p.Name == RandomName || p.Name == SeqName || p.Name == OverlayName || p.Name == RepeatName {
+		return fmt.Errorf("Psalm name is reserved: %s", p.Name)
+	} else if Find(p.Name) != nil {
+		return fmt.Errorf("Psalm already registered: %s", p.Name)
+	}
+
+	List = append(List, p)
+	return nil
+}
+
+// Verify that a psalm is well-formed. This is performed by Register(), and
+// should be used prior to incanting psalms that are not registered.
+func (p *Psalm) Verify() error {
+	if p.Name == "" {
+		return errors.New("Psalm name must not be empty")
+	} else if strings.ContainsAny(p.Name, " \t\n") {
+		return fmt.Errorf("Psalm name must not contain whitespace: %s", p.Name)
+	} else if p.Generator == nil {
+		return fmt.Errorf("Psalm \"%s\" has no generator", p.Name)
+	} else if p.Period.Min < 0 || p.Period.Max < p.Period.Min || p.Period.Max > 0xffff {
+		return fmt.Errorf("Psalm \"%s\" has an invalid period range", p.Name)
+	}
+
+	return p.validateParams()
+}
+
+// Register a psalm, panicking if it is invalid
+func MustRegister(p Psalm) {
+	if err := Register(p); err != nil {
+		panic(err)
+	}
+}
+
+func (p *Psalm) validate(args []string, period uint16) (Args, error) {
+	parsed, err := parseArgs(p.Params, args)
+	if err != nil {
+		return Args{}, fmt.Errorf("%s: %s", p.Name, err)
+	}
+
+	if period != 0 && p.Period.Max > 0 && (int(period) < p.Period.Min || int(period) > p.Period.Max) {
+		return Args{}, fmt.Errorf("%s: Period of %d ms is outside of the supported range (%d-%d ms)",
+			p.Name, period, p.Period.Min, p.Period.Max)
+	}
+
+	return parsed, nil
+}
+
+// Validate the arguments and period (in ms) for the named psalm,
+// without generating its frames. A period of 0 denotes the default period.
+//
+// The length of a composition depends upon the frames of the psalms it
+// comprises, so it is rendered for a device with the firmware's default
+// configuration to ensure it fits.
+func Validate(name string, args []string, period uint16) error {
+	if expr := strings.Join(append([]string{name}, args...), " "); isComposite(expr) {
+		_, _, err := lookupComposite(expr, period, defaultDevice)
+		return err
+	}
+
+	psalm := Find(name)
+	if psalm == nil {
+		return errors.New("No such psalm: " + name)
+	}
+
+	return psalm.Validate(args, period)
+}
+
+// Validate the arguments and period (in ms) for the psalm, without
+// generating its frames. A period of 0 denotes the default period.
+func (p *Psalm) Validate(args []string, period uint16) error {
+	_, err := p.validate(args, period)
+	return err
+}
+
+// Generate the psalm's frames, after validating its arguments and period.
+// This allows psalms that have not been registered, such as those loaded
+// from scripts, to be incanted. A period of 0 denotes the psalm's default
+// period. Returns the frames and the period to use, in ms.
+func (p *Psalm) Generate(args []string, period uint16, dev Device) ([]frame.Frame, uint16, error) {
+	if dev.LedCount < 1 || dev.LedCount&0x1 != 0 {
+		return []frame.Frame{}, 0, errors.New("Invalid LED count")
+	}
+
+	if dev.LedCount < p.MinLeds {
+		return []frame.Frame{}, 0,
+			fmt.Errorf("%s requires at least %d LEDs. Only %d available.", p.Name, p.MinLeds, dev.LedCount)
+	}
+
+	parsed, err := p.validate(args, period)
+	if err != nil {
+		return []frame.Frame{}, 0, err
+	}
+
+	frames, defaultPeriod, err := p.Generator.Generate(parsed, dev)
+	if err != nil {
+		return []frame.Frame{}, 0, err
+	}
+
+	if period == 0 {
+		period = defaultPeriod
+	}
+
+	return frames, period, nil
+}
+
+// Generate the frames for the named psalm. A period of 0 denotes the psalm's
+// default period. Returns the frames and the period to use, in ms.
+//
+// Psalms may also be combined via composite expressions, such as
+// "seq(pulse ff0000, vortex 00ff00 000000)". The name and arguments are
+// joined by spaces to form the expression, so it need not be provided as a
+// single string. The supported operators are:
+//
+//	seq(a, b, ...)              Play each psalm in turn
+//	overlay(a, b, ...)          Additively blend psalms, looping shorter ones
+//	repeat(n, a[, degrees])     Play a psalm n times, rotating its hue each time
+//
+// Compositions are played at a single period: either the specified period,
+// or the default period of the first psalm in the expression. They are
+// uploaded as a single animation, so psalms that are split across uploads,
+// such as morse, cannot be composed.
+func Lookup(name string, args []string, period uint16, dev Device) ([]frame.Frame, uint16, error) {
+	if expr := strings.Join(append([]string{name}, args...), " "); isComposite(expr) {
+		return lookupComposite(expr, period, dev)
+	}
+
+	psalm := Find(name)
+	if psalm == nil {
+		return []frame.Frame{}, 0, errors.New("No such psalm: " + name)
 	}
 
-	return []frame.Frame{}, 0, errors.New("No such psalm: " + name)
+	return psalm.Generate(args, period, dev)
 }
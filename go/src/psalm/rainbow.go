@@ -0,0 +1,55 @@
+// SPDX License Identifier: MIT
+package psalm
+
+import (
+	"errors"
+
+	"github.com/jynik/skullsup/go/src/color"
+	"github.com/jynik/skullsup/go/src/frame"
+)
+
+func rainbow(args Args, dev Device) ([]frame.Frame, uint16, error) {
+	var frames []frame.Frame
+
+	sat := args.Float("saturation")
+	val := args.Float("brightness")
+	limit := dev.frameLimit()
+
+	// The entire skull shifts through each hue in unison
+	if args.Enum("mode") == "cycle" {
+		steps := limit
+		if steps > 36 {
+			steps = 36
+		}
+
+		for s := uint(0); s < steps; s++ {
+			hue := 360 * float64(s) / float64(steps)
+			frames = append(frames, frame.NewColor(color.FromHSV(hue, sat, val)))
+		}
+
+		return frames, 100, nil
+	}
+
+	// Hues are spread along each strip, and rotate with each step. Every
+	// LED changes in every step, so the number of steps is constrained by
+	// the device's frame buffer.
+	steps := limit / dev.LedCount
+	if steps < 1 {
+		return nil, 0, errors.New("rainbow wheel requires more frames than are available.")
+	} else if steps > 12 {
+		steps = 12
+	}
+
+	stripLen := float64(dev.stripLen())
+
+	for s := uint(0); s < steps; s++ {
+		for i := uint(0); i < dev.LedCount; i++ {
+			hue := 360 * (float64(dev.position(i))/stripLen + float64(s)/float64(steps))
+			f := frame.Frame{Led: uint8(i), Color: color.FromHSV(hue, sat, val)}
+			frames = append(frames, f)
+		}
+		frames[len(frames)-1].Delay = true
+	}
+
+	return frames, 250, nil
+}
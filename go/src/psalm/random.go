@@ -3,26 +3,54 @@ package psalm
 
 import (
 	"math/rand"
-	"strings"
+	"strconv"
 
 	"github.com/jynik/skullsup/go/src/color"
 )
 
-func randomArgs(p *Psalm) []string {
-	// 10% of the time us the default args
-	if rand.Intn(10) == 0 {
-		return []string{p.Name}
+// Generate a random value for a parameter, following any recommended
+// luma range for colors or range for numeric values.
+func randomArg(rng *rand.Rand, p *Param) string {
+	switch p.Type {
+	case ArgColor:
+		luma := p.Luma
+		if luma.Max == 0 {
+			luma = Range{0, 256}
+		}
+		return color.Random(rng, luma.Min, luma.Max).String()
+
+	case ArgInt, ArgDuration:
+		if p.hasRange() {
+			return strconv.Itoa(int(p.Min) + rng.Intn(int(p.Max-p.Min)+1))
+		}
+
+	case ArgFloat:
+		if p.hasRange() {
+			return strconv.FormatFloat(p.Min+rng.Float64()*(p.Max-p.Min), 'g', 4, 64)
+		}
+
+	case ArgEnum:
+		return p.Choices[rng.Intn(len(p.Choices))]
 	}
 
-	// Otherwise get random colors for each arg, following
-	// the recommended luma ranges
-	args := make([]string, p.Args.Max+1)
-	args[0] = p.Name
+	if p.required() {
+		return strconv.Itoa(int(p.Min))
+	}
+	return p.Default
+}
+
+func randomArgs(rng *rand.Rand, p *Psalm) []string {
+	args := []string{p.Name}
 
-	for i := 0; i < p.Args.Max; i++ {
-		lumaMin := p.Luma[i].Min
-		lumaMax := p.Luma[i].Max
-		args[i+1] = color.Random(lumaMin, lumaMax).String()
+	// 10% of the time use the default args
+	useDefaults := rng.Intn(10) == 0
+
+	for i := range p.Params {
+		param := &p.Params[i]
+		if useDefaults && !param.required() {
+			break
+		}
+		args = append(args, randomArg(rng, param))
 	}
 
 	return args
@@ -30,16 +58,15 @@ func randomArgs(p *Psalm) []string {
 
 // If a psalm name is provided, return that psalm name with random arguments.
 // If the name is empty or invalid, choose a random psalm with random args.
-func Random(name string) []string {
-	name = strings.ToLower(name)
-	for _, psalm := range List {
-		if name == psalm.Name {
-			return randomArgs(&psalm)
-		}
+// Randomness is drawn from the provided generator, such that the same
+// incantation is produced for a given seed.
+func Random(rng *rand.Rand, name string) []string {
+	if psalm := Find(name); psalm != nil {
+		return randomArgs(rng, psalm)
 	}
 
 	numPsalms := len(List)
-	idx := rand.Intn(numPsalms)
+	idx := rng.Intn(numPsalms)
 	psalm := &List[idx]
-	return randomArgs(psalm)
+	return randomArgs(rng, psalm)
 }
@@ -0,0 +1,134 @@
+// SPDX License Identifier: MIT
+package script
+
+import (
+	"errors"
+	"math"
+
+	"github.com/jynik/skullsup/go/src/color"
+)
+
+type builtin struct {
+	minArgs, maxArgs int         // Argument count. maxArgs < 0 denotes no limit.
+	kinds            []valueKind // Required types of leading arguments
+	fn               func(e *env, args []value) (value, error)
+}
+
+var (
+	num3     = []valueKind{kindNumber, kindNumber, kindNumber}
+	numbers  = []valueKind{kindNumber, kindNumber}
+	colorNum = []valueKind{kindColor, kindNumber}
+)
+
+func math1(f func(float64) float64) builtin {
+	return builtin{1, 1, []valueKind{kindNumber}, func(e *env, args []value) (value, error) {
+		return number(f(args[0].num)), nil
+	}}
+}
+
+func component(f func(c color.Color) uint8) builtin {
+	return builtin{1, 1, []valueKind{kindColor}, func(e *env, args []value) (value, error) {
+		return number(float64(f(args[0].color))), nil
+	}}
+}
+
+func clampComponent(x float64) uint8 {
+	return uint8(math.Max(0, math.Min(255, x+0.5)))
+}
+
+var builtins map[string]builtin
+
+func init() {
+	builtins = map[string]builtin{
+		// Colors
+		"rgb": {3, 3, num3, func(e *env, args []value) (value, error) {
+			return colorValue(color.Color{
+				Red:   clampComponent(args[0].num),
+				Green: clampComponent(args[1].num),
+				Blue:  clampComponent(args[2].num),
+			}), nil
+		}},
+
+		"hsv": {3, 3, num3, func(e *env, args []value) (value, error) {
+			return colorValue(color.FromHSV(args[0].num, args[1].num, args[2].num)), nil
+		}},
+
+		"hsl": {3, 3, num3, func(e *env, args []value) (value, error) {
+			return colorValue(color.FromHSL(args[0].num, args[1].num, args[2].num)), nil
+		}},
+
+		"color": {1, 1, []valueKind{kindString}, func(e *env, args []value) (value, error) {
+			c, err := color.New(args[0].str)
+			return colorValue(c), err
+		}},
+
+		"lerp": {3, 3, nil, func(e *env, args []value) (value, error) {
+			a, b, t := args[0], args[1], args[2]
+			if t.kind != kindNumber {
+				return value{}, errors.New("Position must be a number")
+			} else if a.kind == kindNumber && b.kind == kindNumber {
+				return number(a.num + (b.num-a.num)*t.num), nil
+			} else if a.kind == kindColor && b.kind == kindColor {
+				return colorValue(a.color.LerpGamma(b.color, t.num)), nil
+			}
+			return value{}, errors.New("Cannot interpolate between a number and a color")
+		}},
+
+		"scale": {2, 2, colorNum, func(e *env, args []value) (value, error) {
+			return colorValue(scaleColor(args[0].color, args[1].num)), nil
+		}},
+
+		"rotate": {2, 2, colorNum, func(e *env, args []value) (value, error) {
+			return colorValue(args[0].color.RotateHue(args[1].num)), nil
+		}},
+
+		"red":   component(func(c color.Color) uint8 { return c.Red }),
+		"green": component(func(c color.Color) uint8 { return c.Green }),
+		"blue":  component(func(c color.Color) uint8 { return c.Blue }),
+
+		"gradient": {3, -1, []valueKind{kindNumber}, func(e *env, args []value) (value, error) {
+			var colors []color.Color
+			for _, arg := range args[1:] {
+				if arg.kind != kindColor {
+					return value{}, errors.New("Gradient stops must be colors")
+				}
+				colors = append(colors, arg.color)
+			}
+			return colorValue(color.NewGradient(colors...).At(args[0].num)), nil
+		}},
+
+		"palette": {2, 2, []valueKind{kindString, kindNumber}, func(e *env, args []value) (value, error) {
+			p, err := color.LookupPalette(args[0].str)
+			if err != nil {
+				return value{}, err
+			}
+			return colorValue(p.Gradient().At(args[1].num)), nil
+		}},
+
+		// Math
+		"sin":   math1(math.Sin),
+		"cos":   math1(math.Cos),
+		"abs":   math1(math.Abs),
+		"floor": math1(math.Floor),
+		"ceil":  math1(math.Ceil),
+		"sqrt":  math1(math.Sqrt),
+
+		"min": {2, 2, numbers, func(e *env, args []value) (value, error) {
+			return number(math.Min(args[0].num, args[1].num)), nil
+		}},
+
+		"max": {2, 2, numbers, func(e *env, args []value) (value, error) {
+			return number(math.Max(args[0].num, args[1].num)), nil
+		}},
+
+		"clamp": {3, 3, num3, func(e *env, args []value) (value, error) {
+			return number(math.Max(args[1].num, math.Min(args[2].num, args[0].num))), nil
+		}},
+
+		// Pseudo-random value in [0, 1). The sequence is the same each time
+		// a script is run, such that its animation is reproducible.
+		"rand": {0, 0, nil, func(e *env, args []value) (value, error) {
+			return number(e.rng.Float64()), nil
+		}},
+	}
+}
@@ -0,0 +1,254 @@
+// SPDX License Identifier: MIT
+package script
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/jynik/skullsup/go/src/color"
+)
+
+type valueKind int
+
+const (
+	kindNumber valueKind = iota
+	kindColor
+	kindString
+)
+
+func (k valueKind) String() string {
+	switch k {
+	case kindNumber:
+		return "number"
+	case kindColor:
+		return "color"
+	default:
+		return "string"
+	}
+}
+
+type value struct {
+	kind  valueKind
+	num   float64
+	color color.Color
+	str   string
+}
+
+func number(x float64) value {
+	return value{kind: kindNumber, num: x}
+}
+
+func colorValue(c color.Color) value {
+	return value{kind: kindColor, color: c}
+}
+
+func boolean(b bool) value {
+	if b {
+		return number(1)
+	}
+	return number(0)
+}
+
+func (v value) truthy() bool {
+	switch v.kind {
+	case kindNumber:
+		return v.num != 0
+	case kindColor:
+		return v.color != color.Color{}
+	default:
+		return v.str != ""
+	}
+}
+
+// Evaluation environment
+type env struct {
+	vars map[string]value
+	rng  *rand.Rand
+}
+
+func (n *literalNode) eval(e *env) (value, error) {
+	return n.v, nil
+}
+
+func (n *identNode) eval(e *env) (value, error) {
+	if v, ok := e.vars[n.name]; ok {
+		return v, nil
+	}
+	return value{}, fmt.Errorf("Undefined variable: %s", n.name)
+}
+
+func (n *unaryNode) eval(e *env) (value, error) {
+	v, err := n.operand.eval(e)
+	if err != nil {
+		return value{}, err
+	}
+
+	switch {
+	case n.op == "!":
+		return boolean(!v.truthy()), nil
+	case v.kind == kindNumber:
+		return number(-v.num), nil
+	}
+
+	return value{}, fmt.Errorf("Cannot negate a %s", v.kind)
+}
+
+func (n *ternaryNode) eval(e *env) (value, error) {
+	cond, err := n.cond.eval(e)
+	if err != nil {
+		return value{}, err
+	}
+
+	if cond.truthy() {
+		return n.then.eval(e)
+	}
+	return n.otherwise.eval(e)
+}
+
+// Scale each of a color's components, saturating as needed
+func scaleColor(c color.Color, x float64) color.Color {
+	s := func(v uint8) uint8 {
+		return uint8(math.Max(0, math.Min(255, float64(v)*x+0.5)))
+	}
+	return color.Color{Red: s(c.Red), Green: s(c.Green), Blue: s(c.Blue)}
+}
+
+func subtract(a, b color.Color) color.Color {
+	s := func(x, y uint8) uint8 {
+		if x < y {
+			return 0
+		}
+		return x - y
+	}
+	return color.Color{
+		Red:   s(a.Red, b.Red),
+		Green: s(a.Green, b.Green),
+		Blue:  s(a.Blue, b.Blue),
+	}
+}
+
+func numericOp(op string, a, b float64) (value, error) {
+	switch op {
+	case "+":
+		return number(a + b), nil
+	case "-":
+		return number(a - b), nil
+	case "*":
+		return number(a * b), nil
+	case "/":
+		if b == 0 {
+			return value{}, errors.New("Division by zero")
+		}
+		return number(a / b), nil
+	case "%":
+		if b == 0 {
+			return value{}, errors.New("Division by zero")
+		}
+		return number(math.Mod(a, b)), nil
+	case "^":
+		return number(math.Pow(a, b)), nil
+	case "<":
+		return boolean(a < b), nil
+	case "<=":
+		return boolean(a <= b), nil
+	case ">":
+		return boolean(a > b), nil
+	case ">=":
+		return boolean(a >= b), nil
+	case "==":
+		return boolean(a == b), nil
+	case "!=":
+		return boolean(a != b), nil
+	}
+	return value{}, fmt.Errorf("Invalid operator: %s", op)
+}
+
+func colorOp(op string, a, b value) (value, error) {
+	switch {
+	case a.kind == kindColor && b.kind == kindColor:
+		switch op {
+		case "+":
+			return colorValue(a.color.Add(b.color)), nil
+		case "-":
+			return colorValue(subtract(a.color, b.color)), nil
+		case "*":
+			return colorValue(a.color.Multiply(b.color)), nil
+		case "==":
+			return boolean(a.color == b.color), nil
+		case "!=":
+			return boolean(a.color != b.color), nil
+		}
+
+	case a.kind == kindColor && b.kind == kindNumber:
+		switch op {
+		case "*":
+			return colorValue(scaleColor(a.color, b.num)), nil
+		case "/":
+			if b.num == 0 {
+				return value{}, errors.New("Division by zero")
+			}
+			return colorValue(scaleColor(a.color, 1/b.num)), nil
+		}
+
+	case a.kind == kindNumber && b.kind == kindColor:
+		if op == "*" {
+			return colorValue(scaleColor(b.color, a.num)), nil
+		}
+	}
+
+	return value{}, fmt.Errorf("Invalid operation: %s %s %s", a.kind, op, b.kind)
+}
+
+func (n *binaryNode) eval(e *env) (value, error) {
+	left, err := n.left.eval(e)
+	if err != nil {
+		return value{}, err
+	}
+
+	// Short-circuit logical operators
+	if n.op == "&&" && !left.truthy() {
+		return boolean(false), nil
+	} else if n.op == "||" && left.truthy() {
+		return boolean(true), nil
+	}
+
+	right, err := n.right.eval(e)
+	if err != nil {
+		return value{}, err
+	}
+
+	if n.op == "&&" || n.op == "||" {
+		return boolean(right.truthy()), nil
+	} else if left.kind == kindNumber && right.kind == kindNumber {
+		return numericOp(n.op, left.num, right.num)
+	}
+
+	return colorOp(n.op, left, right)
+}
+
+func (n *callNode) eval(e *env) (value, error) {
+	b := builtins[n.name]
+	if len(n.args) < b.minArgs || (b.maxArgs >= 0 && len(n.args) > b.maxArgs) {
+		return value{}, fmt.Errorf("Invalid number of arguments to %s()", n.name)
+	}
+
+	args := make([]value, len(n.args))
+	for i, arg := range n.args {
+		var err error
+		if args[i], err = arg.eval(e); err != nil {
+			return value{}, err
+		}
+
+		if i < len(b.kinds) && args[i].kind != b.kinds[i] {
+			return value{}, fmt.Errorf("Argument %d to %s() must be a %s", i+1, n.name, b.kinds[i])
+		}
+	}
+
+	v, err := b.fn(e, args)
+	if err != nil {
+		return value{}, fmt.Errorf("%s(): %s", n.name, err)
+	}
+	return v, nil
+}
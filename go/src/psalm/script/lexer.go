@@ -0,0 +1,99 @@
+// SPDX License Identifier: MIT
+package script
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokColor  // #rgb or #rrggbb literal
+	tokString // "..." literal
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	col  int
+}
+
+// Operators, longest first so that they are matched greedily
+var operators = []string{
+	"==", "!=", "<=", ">=", "&&", "||",
+	"+", "-", "*", "/", "%", "^", "<", ">", "!", "?", ":", "(", ")", ",",
+}
+
+func isIdentRune(r rune, first bool) bool {
+	return r == '_' || unicode.IsLetter(r) || (!first && unicode.IsDigit(r))
+}
+
+// Split an expression into tokens
+func lex(s string) ([]token, error) {
+	var tokens []token
+	runes := []rune(s)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		start := i
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{tokNumber, string(runes[start:i]), start})
+
+		case r == '#':
+			i++
+			for i < len(runes) && strings.ContainsRune("0123456789abcdefABCDEF", runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{tokColor, string(runes[start:i]), start})
+
+		case r == '"':
+			i++
+			for i < len(runes) && runes[i] != '"' {
+				i++
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("Unterminated string at column %d", start+1)
+			}
+			i++
+			tokens = append(tokens, token{tokString, string(runes[start+1 : i-1]), start})
+
+		case isIdentRune(r, true):
+			for i < len(runes) && isIdentRune(runes[i], false) {
+				i++
+			}
+			tokens = append(tokens, token{tokIdent, string(runes[start:i]), start})
+
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(string(runes[i:]), op) {
+					tokens = append(tokens, token{tokOp, op, start})
+					i += len([]rune(op))
+					matched = true
+					break
+				}
+			}
+
+			if !matched {
+				return nil, fmt.Errorf("Unexpected character '%c' at column %d", r, start+1)
+			}
+		}
+	}
+
+	return append(tokens, token{tokEOF, "", len(runes)}), nil
+}
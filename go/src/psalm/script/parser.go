@@ -0,0 +1,273 @@
+// SPDX License Identifier: MIT
+package script
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/jynik/skullsup/go/src/color"
+)
+
+// Expression syntax tree node
+type node interface {
+	eval(e *env) (value, error)
+}
+
+type literalNode struct {
+	v value
+}
+
+type identNode struct {
+	name string
+}
+
+type unaryNode struct {
+	op      string
+	operand node
+}
+
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+type ternaryNode struct {
+	cond, then, otherwise node
+}
+
+type callNode struct {
+	name string
+	args []node
+}
+
+// Recursive descent expression parser. In order of increasing precedence:
+//
+//	cond ? a : b
+//	||
+//	&&
+//	== != < <= > >=
+//	+ -
+//	* / %
+//	unary - !
+//	^ (right associative)
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// Parse an expression
+func parseExpr(s string) (node, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	n, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.unexpected(t)
+	}
+
+	return n, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// Consume the next token if it is one of the specified operators
+func (p *parser) accept(ops ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokOp {
+		return "", false
+	}
+
+	for _, op := range ops {
+		if t.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) expect(op string) error {
+	if _, ok := p.accept(op); !ok {
+		return fmt.Errorf("Expected '%s' at column %d", op, p.peek().col+1)
+	}
+	return nil
+}
+
+func (p *parser) unexpected(t token) error {
+	if t.kind == tokEOF {
+		return fmt.Errorf("Unexpected end of expression")
+	}
+	return fmt.Errorf("Unexpected '%s' at column %d", t.text, t.col+1)
+}
+
+func (p *parser) ternary() (node, error) {
+	cond, err := p.binary(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := p.accept("?"); !ok {
+		return cond, nil
+	}
+
+	then, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+
+	otherwise, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ternaryNode{cond, then, otherwise}, nil
+}
+
+// Binary operators, by increasing precedence
+var precedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *parser) binary(level int) (node, error) {
+	if level >= len(precedence) {
+		return p.unary()
+	}
+
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op, ok := p.accept(precedence[level]...)
+		if !ok {
+			return left, nil
+		}
+
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op, left, right}
+	}
+}
+
+func (p *parser) unary() (node, error) {
+	if op, ok := p.accept("-", "!"); ok {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op, operand}, nil
+	}
+
+	return p.power()
+}
+
+func (p *parser) power() (node, error) {
+	base, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := p.accept("^"); ok {
+		exp, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &binaryNode{"^", base, exp}, nil
+	}
+
+	return base, nil
+}
+
+func (p *parser) primary() (node, error) {
+	t := p.next()
+
+	switch t.kind {
+	case tokNumber:
+		x, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid number: %s", t.text)
+		}
+		return &literalNode{number(x)}, nil
+
+	case tokColor:
+		c, err := color.New(t.text)
+		if err != nil {
+			return nil, err
+		}
+		return &literalNode{colorValue(c)}, nil
+
+	case tokString:
+		return &literalNode{value{kind: kindString, str: t.text}}, nil
+
+	case tokIdent:
+		if _, ok := p.accept("("); !ok {
+			return &identNode{t.text}, nil
+		}
+		return p.call(t.text)
+
+	case tokOp:
+		if t.text == "(" {
+			n, err := p.ternary()
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+		}
+	}
+
+	return nil, p.unexpected(t)
+}
+
+// Parse a function call's arguments, following the opening parenthesis
+func (p *parser) call(name string) (node, error) {
+	if _, ok := builtins[name]; !ok {
+		return nil, fmt.Errorf("Unknown function: %s", name)
+	}
+
+	n := &callNode{name: name}
+	if _, ok := p.accept(")"); ok {
+		return n, nil
+	}
+
+	for {
+		arg, err := p.ternary()
+		if err != nil {
+			return nil, err
+		}
+		n.args = append(n.args, arg)
+
+		if _, ok := p.accept(")"); ok {
+			return n, nil
+		} else if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
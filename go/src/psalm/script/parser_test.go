@@ -0,0 +1,170 @@
+// SPDX License Identifier: MIT
+package script
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func evalExpr(s string) (value, error) {
+	n, err := parseExpr(s)
+	if err != nil {
+		return value{}, err
+	}
+
+	e := &env{
+		vars: map[string]value{"x": number(2), "zero": number(0)},
+		rng:  rand.New(rand.NewSource(1)),
+	}
+	return n.eval(e)
+}
+
+func TestPrecedence(t *testing.T) {
+	tests := []struct {
+		expr string
+		want float64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"10 - 4 - 3", 3},
+		{"24 / 4 / 2", 3},
+		{"7 % 4 * 2", 6},
+		{"2 ^ 3 ^ 2", 512},
+		{"-2 ^ 2", -4},
+		{"2 ^ -1", 0.5},
+		{"2 * 3 ^ 2", 18},
+		{"- -3", 3},
+		{"!0 + 1", 2},
+		{"1 + 2 == 3", 1},
+		{"1 + 2 != 3", 0},
+		{"1 < 2 == 1", 1},
+		{"2 <= 2 && 3 >= 4", 0},
+		{"0 || 1 && 0", 0},
+		{"1 || 0 && 0", 1},
+		{"x * x + 1", 5},
+		{"sin(0) + max(1, 2) * 3", 6},
+		{"clamp(x * 10, 0, 15)", 15},
+	}
+
+	for _, test := range tests {
+		v, err := evalExpr(test.expr)
+		if err != nil {
+			t.Errorf("%s: %s", test.expr, err)
+		} else if v.kind != kindNumber || v.num != test.want {
+			t.Errorf("%s: expected %g, got %+v", test.expr, test.want, v)
+		}
+	}
+}
+
+func TestTernary(t *testing.T) {
+	tests := []struct {
+		expr string
+		want float64
+	}{
+		{"1 ? 2 : 3", 2},
+		{"0 ? 2 : 3", 3},
+		{"x > 1 ? 10 : 20", 10},
+		{"1 + 1 ? 10 : 20", 10},
+		{"0 ? 1 : 0 ? 2 : 3", 3},
+		{"0 ? 1 : 1 ? 2 : 3", 2},
+		{"1 ? 0 ? 4 : 5 : 6", 5},
+		{"(x ? 3 : 4) * 2", 6},
+
+		// The untaken branch is not evaluated
+		{"1 ? 1 : 1 / zero", 1},
+		{"0 && 1 / zero", 0},
+		{"1 || 1 / zero", 1},
+	}
+
+	for _, test := range tests {
+		v, err := evalExpr(test.expr)
+		if err != nil {
+			t.Errorf("%s: %s", test.expr, err)
+		} else if v.num != test.want {
+			t.Errorf("%s: expected %g, got %g", test.expr, test.want, v.num)
+		}
+	}
+}
+
+func TestColorOperations(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"#ff0000", "ff0000"},
+		{"#f00 + #00ff00", "ffff00"},
+		{"#ff8000 - #800000", "7f8000"},
+		{"#ff0000 - #00ff00", "ff0000"},
+		{"#ff0000 * 0.5", "800000"},
+		{"0.5 * #ff0000", "800000"},
+		{"#400000 * 8", "ff0000"},
+		{"#ff0000 / 2", "800000"},
+		{"rgb(255, 128, 0)", "ff8000"},
+		{"hsv(120, 1, 1)", "00ff00"},
+		{"color(\"red\")", "ff0000"},
+		{"x > 1 ? #0000ff : #ff0000", "0000ff"},
+	}
+
+	for _, test := range tests {
+		v, err := evalExpr(test.expr)
+		if err != nil {
+			t.Errorf("%s: %s", test.expr, err)
+		} else if v.kind != kindColor || v.color.String() != test.want {
+			t.Errorf("%s: expected %s, got %+v", test.expr, test.want, v)
+		}
+	}
+}
+
+func TestParseExprErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{"nosuch(1)", "Unknown function: nosuch"},
+		{"1 +", "Unexpected end of expression"},
+		{"(1 + 2", "Expected ')'"},
+		{"1 ? 2", "Expected ':'"},
+		{"1 2", "Unexpected '2'"},
+		{"max(1, 2", "Expected ','"},
+		{"* 2", "Unexpected '*'"},
+		{"#12", "Invalid color"},
+		{"", "Unexpected end of expression"},
+	}
+
+	for _, test := range tests {
+		_, err := parseExpr(test.expr)
+		if err == nil {
+			t.Errorf("%q: expected an error", test.expr)
+		} else if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: expected %q, got %q", test.expr, test.err, err)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{"1 / 0", "Division by zero"},
+		{"1 / zero", "Division by zero"},
+		{"x % 0", "Division by zero"},
+		{"#ff0000 / 0", "Division by zero"},
+		{"y + 1", "Undefined variable: y"},
+		{"-#ff0000", "Cannot negate a color"},
+		{"#ff0000 + 1", "Invalid operation"},
+		{"1 - #ff0000", "Invalid operation"},
+		{"sin(1, 2)", "Invalid number of arguments to sin()"},
+		{"rgb(#ff0000, 0, 0)", "Argument 1 to rgb() must be a number"},
+	}
+
+	for _, test := range tests {
+		_, err := evalExpr(test.expr)
+		if err == nil {
+			t.Errorf("%q: expected an error", test.expr)
+		} else if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: expected %q, got %q", test.expr, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,370 @@
+// SPDX License Identifier: MIT
+
+// Package script implements psalms defined by scripts, allowing animations to
+// be prototyped without recompiling and sent to remote skulls.
+//
+// A script consists of one directive per line. Blank lines and those starting
+// with '#' are ignored.
+//
+//	name <name>                     Psalm name (required)
+//	description <text>              Description shown when listing psalms
+//	author <text>                   Author shown when listing psalms
+//	period <ms> [<min> <max>]       Default and supported frame period
+//	steps <n>                       Number of animation steps (default: 1)
+//	param <name> <type> [default]   Argument: color, int, float, or duration
+//	let <var> = <expr>              Assign a variable
+//	led = <expr>                    Color of each LED (required)
+//
+// For each animation step, the "let" expressions are evaluated in order, and
+// then the "led" expression is evaluated for each LED. The following
+// variables are available, in addition to the psalm's arguments:
+//
+//	i          LED number
+//	t          Animation step, from 0 to steps-1
+//	steps      Number of animation steps
+//	n          Number of LEDs
+//	strip      Strip containing the LED
+//	pos        Position of the LED within its strip
+//	strips     Number of strips
+//	striplen   Number of LEDs per strip
+//	pi         3.14159...
+//
+// Expressions support numbers, colors (e.g., #ff0000), and the following
+// operators: + - * / % ^ == != < <= > >= && || ! and cond ? a : b.
+// Colors may be added, subtracted, multiplied, and scaled by numbers.
+//
+// The following functions are available:
+//
+//	rgb(r, g, b)          Color from components in [0, 255]
+//	hsv(h, s, v)          Color from hue in degrees, and s and v in [0, 1]
+//	hsl(h, s, l)          Color from hue in degrees, and s and l in [0, 1]
+//	color("name")         Color from any string accepted by color.New()
+//	lerp(a, b, x)         Interpolate between two numbers or colors
+//	scale(c, x)           Scale a color's brightness
+//	rotate(c, deg)        Rotate a color's hue
+//	red(c), green(c), blue(c)
+//	gradient(x, c1, c2, ...)
+//	palette("name", x)    Sample a palette's gradient at x, in [0, 1]
+//	sin, cos, abs, floor, ceil, sqrt, min, max, clamp(x, lo, hi)
+//	rand()                Pseudo-random number in [0, 1)
+package script
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/jynik/skullsup/go/src/color"
+	"github.com/jynik/skullsup/go/src/file"
+	"github.com/jynik/skullsup/go/src/frame"
+	"github.com/jynik/skullsup/go/src/psalm"
+)
+
+// Default frame period, in ms, if a script does not specify one
+const DefaultPeriod = 100
+
+// Maximum number of animation steps
+const MaxSteps = 255
+
+type assignment struct {
+	name string
+	expr node
+}
+
+// Compiled script, which serves as a psalm's generator
+type program struct {
+	steps  int
+	period uint16
+	params []psalm.Param
+	lets   []assignment
+	led    node
+}
+
+// Variables provided to scripts, which may not be reassigned
+var reserved = map[string]bool{
+	"i": true, "t": true, "steps": true, "n": true, "strip": true,
+	"pos": true, "strips": true, "striplen": true, "pi": true,
+}
+
+func checkName(name string, defined map[string]bool) error {
+	tokens, err := lex(name)
+	if err != nil || len(tokens) != 2 || tokens[0].kind != tokIdent {
+		return fmt.Errorf("Invalid name: %s", name)
+	} else if reserved[name] {
+		return fmt.Errorf("Name is reserved: %s", name)
+	} else if defined[name] {
+		return fmt.Errorf("Name is already defined: %s", name)
+	}
+	return nil
+}
+
+func parseParam(s string) (psalm.Param, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 2 {
+		return psalm.Param{}, errors.New("Expected: param <name> <type> [default]")
+	}
+
+	p := psalm.Param{Name: fields[0]}
+	switch strings.ToLower(fields[1]) {
+	case "color":
+		p.Type = psalm.ArgColor
+	case "int":
+		p.Type = psalm.ArgInt
+	case "float":
+		p.Type = psalm.ArgFloat
+	case "duration":
+		p.Type = psalm.ArgDuration
+	default:
+		return psalm.Param{}, fmt.Errorf("Invalid parameter type: %s", fields[1])
+	}
+
+	// Defaults may contain whitespace, e.g., "rgb(1, 2, 3)"
+	if len(fields) > 2 {
+		rest := strings.TrimSpace(s)
+		rest = strings.TrimSpace(rest[len(fields[0]):])
+		p.Default = strings.TrimSpace(rest[len(fields[1]):])
+	}
+
+	return p, nil
+}
+
+func parsePeriod(s string, p *psalm.Psalm, prog *program) error {
+	var vals []int
+	for _, field := range strings.Fields(s) {
+		v, err := strconv.Atoi(field)
+		if err != nil || v <= 0 || v > math.MaxUint16 {
+			return fmt.Errorf("Invalid period: %s", field)
+		}
+		vals = append(vals, v)
+	}
+
+	switch len(vals) {
+	case 1:
+	case 3:
+		p.Period = psalm.Range{Min: vals[1], Max: vals[2]}
+	default:
+		return errors.New("Expected: period <ms> [<min> <max>]")
+	}
+
+	prog.period = uint16(vals[0])
+	return nil
+}
+
+// Split an assignment of the form "<name> = <expr>"
+func splitAssignment(s string) (string, string, error) {
+	eq := strings.Index(s, "=")
+	if eq < 0 || strings.HasPrefix(s[eq:], "==") {
+		return "", "", errors.New("Expected: <name> = <expression>")
+	}
+	return strings.TrimSpace(s[:eq]), strings.TrimSpace(s[eq+1:]), nil
+}
+
+func (prog *program) parseLine(line string, p *psalm.Psalm, defined map[string]bool) error {
+	directive := strings.Fields(line)[0]
+	rest := strings.TrimSpace(line[len(directive):])
+
+	switch strings.ToLower(directive) {
+	case "name":
+		p.Name = strings.ToLower(rest)
+
+	case "description":
+		p.Description = rest
+
+	case "author":
+		p.Author = rest
+
+	case "period":
+		return parsePeriod(rest, p, prog)
+
+	case "steps":
+		steps, err := strconv.Atoi(rest)
+		if err != nil || steps < 1 || steps > MaxSteps {
+			return fmt.Errorf("Steps must be in the range [1, %d]", MaxSteps)
+		}
+		prog.steps = steps
+
+	case "param":
+		param, err := parseParam(rest)
+		if err != nil {
+			return err
+		} else if err := checkName(param.Name, defined); err != nil {
+			return err
+		}
+		defined[param.Name] = true
+		p.Params = append(p.Params, param)
+
+	case "let":
+		name, exprStr, err := splitAssignment(rest)
+		if err != nil {
+			return err
+		} else if err := checkName(name, defined); err != nil {
+			return err
+		}
+
+		expr, err := parseExpr(exprStr)
+		if err != nil {
+			return err
+		}
+		defined[name] = true
+		prog.lets = append(prog.lets, assignment{name, expr})
+
+	case "led":
+		if prog.led != nil {
+			return errors.New("LED expression is already defined")
+		}
+
+		// Allow either "led = <expr>" or "led <expr>"
+		if strings.HasPrefix(rest, "=") && !strings.HasPrefix(rest, "==") {
+			rest = rest[1:]
+		}
+
+		expr, err := parseExpr(rest)
+		if err != nil {
+			return err
+		}
+		prog.led = expr
+
+	default:
+		return fmt.Errorf("Unknown directive: %s", directive)
+	}
+
+	return nil
+}
+
+// Parse a psalm script
+func Parse(source string) (*psalm.Psalm, error) {
+	p := &psalm.Psalm{MinLeds: 1}
+	prog := &program{steps: 1, period: DefaultPeriod}
+	defined := map[string]bool{}
+
+	for i, line := range strings.Split(source, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if err := prog.parseLine(line, p, defined); err != nil {
+			return nil, fmt.Errorf("Line %d: %s", i+1, err)
+		}
+	}
+
+	if prog.led == nil {
+		return nil, errors.New("Script is missing an LED expression")
+	}
+
+	prog.params = p.Params
+	p.Generator = prog
+
+	if err := p.Verify(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Load a psalm script from a file
+func Load(filename string) (*psalm.Psalm, error) {
+	data, err := file.FindAndRead(filename)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(string(data))
+}
+
+// Bind the psalm's arguments to variables
+func (prog *program) bindArgs(args psalm.Args, vars map[string]value) {
+	for _, param := range prog.params {
+		switch param.Type {
+		case psalm.ArgColor:
+			vars[param.Name] = colorValue(args.Color(param.Name))
+		case psalm.ArgInt:
+			vars[param.Name] = number(float64(args.Int(param.Name)))
+		case psalm.ArgFloat:
+			vars[param.Name] = number(args.Float(param.Name))
+		case psalm.ArgDuration:
+			vars[param.Name] = number(args.Duration(param.Name).Seconds() * 1000)
+		}
+	}
+}
+
+func (prog *program) Generate(args psalm.Args, dev psalm.Device) ([]frame.Frame, uint16, error) {
+	var frames []frame.Frame
+
+	if dev.LedCount >= frame.ALL_LEDS {
+		return nil, 0, fmt.Errorf("Unsupported LED count: %d", dev.LedCount)
+	} else if dev.MaxFrames > 0 && uint(prog.steps) > dev.MaxFrames {
+		return nil, 0, fmt.Errorf("Script requires %d steps, but only %d frames are supported", prog.steps, dev.MaxFrames)
+	}
+
+	layout := dev.Layout
+	if layout.LedCount() != dev.LedCount {
+		layout = frame.Layout{NumStrips: 1, StripLen: dev.LedCount}
+	}
+	strips, stripLen := layout.NumStrips, layout.StripLen
+
+	e := &env{
+		vars: map[string]value{
+			"steps":    number(float64(prog.steps)),
+			"n":        number(float64(dev.LedCount)),
+			"strips":   number(float64(strips)),
+			"striplen": number(float64(stripLen)),
+			"pi":       number(math.Pi),
+		},
+		rng: rand.New(rand.NewSource(1)),
+	}
+	prog.bindArgs(args, e.vars)
+
+	colors := make([]color.Color, dev.LedCount)
+
+	for t := 0; t < prog.steps; t++ {
+		e.vars["t"] = number(float64(t))
+
+		for i := uint(0); i < dev.LedCount; i++ {
+			e.vars["i"] = number(float64(i))
+			e.vars["strip"] = number(float64(i / stripLen))
+			e.vars["pos"] = number(float64(layout.Position(i)))
+
+			for _, let := range prog.lets {
+				v, err := let.expr.eval(e)
+				if err != nil {
+					return nil, 0, fmt.Errorf("%s: %s", let.name, err)
+				}
+				e.vars[let.name] = v
+			}
+
+			v, err := prog.led.eval(e)
+			if err != nil {
+				return nil, 0, fmt.Errorf("led: %s", err)
+			} else if v.kind != kindColor {
+				return nil, 0, fmt.Errorf("led: Expected a color, got a %s", v.kind)
+			}
+			colors[i] = v.color
+		}
+
+		frames = append(frames, stepFrames(colors)...)
+	}
+
+	return frames, prog.period, nil
+}
+
+// Frames for a single animation step, with a delay after the last
+func stepFrames(colors []color.Color) []frame.Frame {
+	uniform := true
+	for _, c := range colors {
+		uniform = uniform && c == colors[0]
+	}
+
+	if uniform {
+		return []frame.Frame{frame.NewColor(colors[0])}
+	}
+
+	frames := make([]frame.Frame, len(colors))
+	for i, c := range colors {
+		frames[i] = frame.Frame{Led: uint8(i), Color: c}
+	}
+	frames[len(frames)-1].Delay = true
+	return frames
+}
@@ -0,0 +1,117 @@
+// SPDX License Identifier: MIT
+package script
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jynik/skullsup/go/src/frame"
+	"github.com/jynik/skullsup/go/src/psalm"
+)
+
+var device = psalm.Device{
+	LedCount:  4,
+	Layout:    frame.Layout{NumStrips: 2, StripLen: 2, Flags: frame.LAYOUT_WRAP_INVERT},
+	MaxFrames: 55,
+}
+
+func TestParse(t *testing.T) {
+	p, err := Parse(`
+		# Comments and blank lines are ignored
+		name Gradient
+		description A test script
+		author Someone
+		period 80 40 200
+		steps 2
+		param fg color #ff0000
+		param bg color rgb(0, 0, 255)
+		param gain float 0.5
+		let x = pos / (striplen - 1)
+		led = lerp(bg, fg, x) * gain
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Name != "gradient" || p.Description != "A test script" || p.Author != "Someone" {
+		t.Errorf("Unexpected metadata: %+v", p)
+	} else if p.Period != (psalm.Range{Min: 40, Max: 200}) {
+		t.Errorf("Unexpected period range: %+v", p.Period)
+	} else if len(p.Params) != 3 || p.Params[1].Default != "rgb(0, 0, 255)" {
+		t.Errorf("Unexpected parameters: %+v", p.Params)
+	}
+
+	frames, period, err := p.Generate(nil, 0, device)
+	if err != nil {
+		t.Fatal(err)
+	} else if period != 80 {
+		t.Errorf("Expected a period of 80 ms, got %d", period)
+	} else if len(frames) != 8 {
+		t.Fatalf("Expected 8 frames, got %d", len(frames))
+	}
+
+	// The second strip runs in reverse, so its positions are reversed
+	want := []string{"000080", "800000", "800000", "000080"}
+	for i, c := range want {
+		if got := frames[i].Color.String(); got != c {
+			t.Errorf("LED %d: expected %s, got %s", i, c, got)
+		}
+	}
+}
+
+func TestParseScriptErrors(t *testing.T) {
+	tests := []struct {
+		script string
+		err    string
+	}{
+		{"name x", "missing an LED expression"},
+		{"name x\nled = nosuch(1)", "Line 2: Unknown function: nosuch"},
+		{"name x\nled = #ff0000\nled = #00ff00", "Line 3: LED expression is already defined"},
+		{"name x\nbogus 1\nled = #ff0000", "Line 2: Unknown directive: bogus"},
+		{"name x\nlet pos = 1\nled = #ff0000", "Name is reserved: pos"},
+		{"name x\nlet a = 1\nlet a = 2\nled = #ff0000", "Name is already defined: a"},
+		{"name x\nparam a vector\nled = #ff0000", "Invalid parameter type: vector"},
+		{"name x\nlet a == 1\nled = #ff0000", "Expected: <name> = <expression>"},
+		{"name x\nsteps 0\nled = #ff0000", "Steps must be in the range"},
+		{"name x\nsteps 256\nled = #ff0000", "Steps must be in the range"},
+		{"name x\nperiod 10 20\nled = #ff0000", "Expected: period"},
+		{"name x\nperiod -5\nled = #ff0000", "Invalid period"},
+		{"name x\nled = (1 +", "Line 2: Unexpected end of expression"},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(test.script)
+		if err == nil {
+			t.Errorf("%q: expected an error", test.script)
+		} else if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: expected %q, got %q", test.script, test.err, err)
+		}
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tests := []struct {
+		script string
+		err    string
+	}{
+		{"name x\nled = #ff0000 * (1 / (t - 1))\nsteps 3", "led: Division by zero"},
+		{"name x\nlet a = i % (n - 4)\nled = #ff0000", "a: Division by zero"},
+		{"name x\nled = i", "led: Expected a color, got a number"},
+		{"name x\nsteps 60\nled = #ff0000", "only 55 frames are supported"},
+	}
+
+	for _, test := range tests {
+		p, err := Parse(test.script)
+		if err != nil {
+			t.Errorf("%q: %s", test.script, err)
+			continue
+		}
+
+		_, _, err = p.Generate(nil, 0, device)
+		if err == nil {
+			t.Errorf("%q: expected an error", test.script)
+		} else if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: expected %q, got %q", test.script, test.err, err)
+		}
+	}
+}
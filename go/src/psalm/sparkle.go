@@ -0,0 +1,39 @@
+// SPDX License Identifier: MIT
+package psalm
+
+import (
+	"math/rand"
+
+	"github.com/jynik/skullsup/go/src/frame"
+)
+
+func sparkle(args Args, dev Device) ([]frame.Frame, uint16, error) {
+	var frames []frame.Frame
+
+	fg := args.Color("foreground")
+	bg := args.Color("background")
+
+	density := uint(args.Int("density"))
+	if density > dev.LedCount {
+		density = dev.LedCount
+	}
+
+	// A fixed seed yields the same sparkles each time the psalm is incanted
+	rng := rand.New(rand.NewSource(13))
+
+	steps := dev.frameLimit() / (density + 1)
+	if steps > 16 {
+		steps = 16
+	}
+
+	for s := uint(0); s < steps; s++ {
+		frames = append(frames, frame.Frame{Led: frame.ALL_LEDS, Color: bg, Delay: false})
+
+		for _, led := range rng.Perm(int(dev.LedCount))[:density] {
+			frames = append(frames, frame.Frame{Led: uint8(led), Color: fg})
+		}
+		frames[len(frames)-1].Delay = true
+	}
+
+	return frames, 100, nil
+}
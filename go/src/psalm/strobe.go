@@ -0,0 +1,29 @@
+// SPDX License Identifier: MIT
+package psalm
+
+import (
+	"github.com/jynik/skullsup/go/src/color"
+	"github.com/jynik/skullsup/go/src/frame"
+)
+
+func strobe(args Args, dev Device) ([]frame.Frame, uint16, error) {
+	var frames []frame.Frame
+
+	c := args.Color("color")
+	flashes := args.Int("flashes")
+	rest := args.Int("rest")
+
+	for i := 0; i < flashes; i++ {
+		frames = append(frames, frame.NewColor(c))
+		frames = append(frames, frame.NewColor(color.Color{}))
+	}
+
+	// Linger in the darkness between bursts of flashes
+	frames[len(frames)-1].Duration = uint8(rest + 1)
+
+	if err := dev.checkFrames("strobe", len(frame.Expand(frames))); err != nil {
+		return nil, 0, err
+	}
+
+	return frames, 40, nil
+}
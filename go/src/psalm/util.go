@@ -1,39 +1,73 @@
 // SPDX License Identifier: MIT
 package psalm
 
-import "github.com/jynik/skullsup/go/src/color"
+import (
+	"fmt"
+	"math"
+
+	"github.com/jynik/skullsup/go/src/color"
+	"github.com/jynik/skullsup/go/src/frame"
+)
 
 type Range struct {
 	Min, Max int
 }
 
-func getFgBg(args []string, defaultFg, defaultBg string) (color.Color, color.Color, error) {
-	var fg, bg color.Color
-	var err error
+// Frame limit assumed for devices that do not report one
+const defaultMaxFrames = 55
+
+// Device assumed when validating compositions for an unknown device, which
+// matches the firmware's default hardware configuration
+var defaultDevice = Device{
+	LedCount:  16,
+	Layout:    frame.Layout{NumStrips: 2, StripLen: 8, Flags: frame.LAYOUT_WRAP_INVERT},
+	MaxFrames: defaultMaxFrames,
+}
+
+// Largest frame limit a device may report, as it is reported in a single byte
+const maxFrameLimit = 0xff
 
-	if len(args) >= 1 {
-		if fg, err = color.New(args[0]); err != nil {
-			return fg, bg, err
-		}
-	} else {
-		fg = color.MustCreate(defaultFg)
+// Number of frames available to a psalm
+func (d Device) frameLimit() uint {
+	if d.MaxFrames == 0 {
+		return defaultMaxFrames
 	}
+	return d.MaxFrames
+}
 
-	if len(args) >= 2 {
-		if bg, err = color.New(args[1]); err != nil {
-			return fg, bg, err
-		}
-	} else {
-		bg = color.MustCreate(defaultBg)
+// Ensure an animation fits within the device's frame buffer
+func (d Device) checkFrames(name string, count int) error {
+	if limit := d.frameLimit(); uint(count) > limit {
+		return fmt.Errorf("%s requires %d frames, but only %d are available.", name, count, limit)
 	}
+	return nil
+}
 
-	return fg, bg, nil
+// Does the device's reported layout describe all of its LEDs?
+func (d Device) layoutKnown() bool {
+	return d.Layout.StripLen != 0 && d.Layout.LedCount() == d.LedCount
 }
 
-func mustGetFgBg(args []string, defaultFg, defaultBg string) (color.Color, color.Color) {
-	if fg, bg, err := getFgBg(args, defaultFg, defaultBg); err != nil {
-		panic(err)
-	} else {
-		return fg, bg
+// Number of LEDs per strip. Devices with an unknown layout are treated
+// as a single strip.
+func (d Device) stripLen() uint {
+	if !d.layoutKnown() {
+		return d.LedCount
 	}
+	return d.Layout.StripLen
+}
+
+// Position of an LED along its strip, accounting for strips whose LEDs
+// are numbered in the opposite direction
+func (d Device) position(led uint) uint {
+	if !d.layoutKnown() {
+		return led
+	}
+	return d.Layout.Position(led)
+}
+
+// Scale a color by a brightness in [0, 1]
+func brightness(c color.Color, b float64) color.Color {
+	v := uint8(math.Max(0, math.Min(255, b*255+0.5)))
+	return c.Scale(v, v, v)
 }
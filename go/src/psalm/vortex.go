@@ -3,18 +3,16 @@ package psalm
 
 import "github.com/jynik/skullsup/go/src/frame"
 
-func vortex(args []string, ledCount uint) ([]frame.Frame, uint16, error) {
+func vortex(args Args, dev Device) ([]frame.Frame, uint16, error) {
 	var frames []frame.Frame
 
-	fg, bg, err := getFgBg(args, "ff0000", "000505")
-	if err != nil {
-		return []frame.Frame{}, 0, err
-	}
+	fg := args.Color("foreground")
+	bg := args.Color("background")
 
-	for i := uint(0); i < ledCount; i++ {
-		frames = append(frames, frame.Frame{frame.ALL_LEDS, bg, false})
-		frames = append(frames, frame.Frame{uint8(i), fg, true})
+	for i := uint(0); i < dev.LedCount; i++ {
+		frames = append(frames, frame.Frame{Led: frame.ALL_LEDS, Color: bg, Delay: false})
+		frames = append(frames, frame.Frame{Led: uint8(i), Color: fg, Delay: true})
 	}
 
-	return frames, 40, nil
+	return frames, 65, nil
 }